@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// onCallAlerts are the open alerts owned by one person currently on call
+type onCallAlerts struct {
+	Entry      opsgenie.RosterEntry
+	Open       int
+	Priorities map[string]int // alert priority (P1-P5) -> count
+}
+
+func runAlertsCommand(args []string) error {
+	alertsFlags := flag.NewFlagSet("alerts", flag.ExitOnError)
+	filterFlag := alertsFlags.String("filter", "", "Comma-separated list of schedule names or IDs to filter")
+	enabledOnly := addEnabledOnlyFlag(alertsFlags)
+	clientSideFilter := addClientSideFilterFlag(alertsFlags)
+	limit := alertsFlags.Int("limit", 500, "Maximum number of open alerts to fetch (paginated, newest first)")
+	format := alertsFlags.String("format", "auto", "Output format: auto (table on a terminal, json when piped), table, json")
+	jsonIndent := addJSONIndentFlag(alertsFlags)
+
+	clientOpts := addClientFlags(alertsFlags)
+
+	alertsFlags.Parse(args)
+
+	if *limit <= 0 {
+		return validationError("-limit must be positive")
+	}
+	*format = resolveFormat(*format, false)
+	switch *format {
+	case "table", "json":
+	default:
+		return validationError("invalid -format value %q (expected auto, table or json)", *format)
+	}
+
+	filters := scheduleFilters(args, *filterFlag, false)
+
+	client, cleanup, err := clientOpts.newClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	schedules, err := selectSchedules(client, filters, *enabledOnly, !*clientSideFilter)
+	if err != nil {
+		return err
+	}
+	// JSON output is still written, with no one on call, when no schedule matches
+	if len(schedules) == 0 && *format != "json" {
+		return nil
+	}
+
+	at := time.Now().UTC()
+	statuses := client.Statuses(schedules, at)
+	logStatusWarnings(statuses)
+
+	alerts, err := client.OpenAlerts(*limit)
+	if err != nil {
+		return err
+	}
+	if len(alerts) == *limit {
+		log.Printf("Warning: fetched the maximum of %d open alerts; counts may be incomplete (raise -limit)", *limit)
+	}
+
+	people := groupAlerts(opsgenie.Roster(statuses), alerts)
+	if *format == "json" {
+		if err := writeJSON(os.Stdout, newAlertsJSON(people, at, len(alerts)), *jsonIndent); err != nil {
+			return err
+		}
+		return partialFailure(statuses)
+	}
+
+	fmt.Printf("%-40s %-40s %-12s %s\n", "Name", "Schedules", "Open Alerts", "Priorities")
+	fmt.Println(strings.Repeat("=", 140))
+	for _, person := range people {
+		schedules := make([]string, 0, len(person.Entry.Schedules))
+		for _, schedule := range person.Entry.Schedules {
+			schedules = append(schedules, cleanScheduleName(schedule))
+		}
+		fmt.Printf("%s %s %-12d %s\n", padRight(truncate(formatRecipients([]string{person.Entry.Name}), 38), 40),
+			padRight(truncate(strings.Join(schedules, ", "), 38), 40), person.Open, formatPriorities(person.Priorities))
+	}
+	return partialFailure(statuses)
+}
+
+// groupAlerts counts the open alerts owned by each person on the roster, busiest first
+func groupAlerts(roster []opsgenie.RosterEntry, alerts []opsgenie.Alert) []onCallAlerts {
+	people := make([]onCallAlerts, 0, len(roster))
+	index := make(map[string]int, len(roster))
+	for i, entry := range roster {
+		people = append(people, onCallAlerts{Entry: entry, Priorities: make(map[string]int)})
+		index[strings.ToLower(entry.Name)] = i
+	}
+	for _, alert := range alerts {
+		i, ok := index[strings.ToLower(alert.Owner)]
+		if !ok {
+			continue
+		}
+		people[i].Open++
+		people[i].Priorities[alert.Priority]++
+	}
+	sort.SliceStable(people, func(i, j int) bool {
+		return people[i].Open > people[j].Open
+	})
+	return people
+}
+
+// formatPriorities renders priority counts highest priority first, e.g. "P1: 2, P3: 1"
+func formatPriorities(priorities map[string]int) string {
+	var keys []string
+	for priority := range priorities {
+		keys = append(keys, priority)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, priority := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %d", priority, priorities[priority]))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// newPseudonyms maps every person of report to a stable pseudonym for -anonymize: "Person A"
+// for the most hours, "Person B" for the next and so on, ties broken by name. Recipients
+// left out by -exclude-person follow, also by hours.
+func newPseudonyms(report *opsgenie.Report) map[string]string {
+	type ranked struct {
+		name  string
+		hours float64
+	}
+	byHours := func(people []ranked) []ranked {
+		sort.Slice(people, func(i, j int) bool {
+			if people[i].hours != people[j].hours {
+				return people[i].hours > people[j].hours
+			}
+			return people[i].name < people[j].name
+		})
+		return people
+	}
+
+	var people, excluded []ranked
+	for name, pdata := range report.People {
+		people = append(people, ranked{name, pdata.TotalHours})
+	}
+	for name, hours := range report.ExcludedHours {
+		excluded = append(excluded, ranked{name, hours})
+	}
+
+	pseudonyms := make(map[string]string, len(people)+len(excluded))
+	for _, person := range append(byHours(people), byHours(excluded)...) {
+		if _, ok := pseudonyms[person.name]; !ok {
+			pseudonyms[person.name] = "Person " + pseudonymLetters(len(pseudonyms))
+		}
+	}
+	return pseudonyms
+}
+
+// pseudonymLetters numbers pseudonyms like spreadsheet columns: A to Z, then AA, AB, ...
+func pseudonymLetters(i int) string {
+	letters := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		letters = string(rune('A'+(i-1)%26)) + letters
+	}
+	return letters
+}
+
+// pseudonym returns the pseudonym of name, never the name itself
+func pseudonym(pseudonyms map[string]string, name string) string {
+	if alias, ok := pseudonyms[name]; ok {
+		return alias
+	}
+	return "Person ?"
+}
+
+// anonymizeReport returns a copy of report with every name replaced by its pseudonym:
+// people, overlaps and excluded recipients. Hours are unchanged.
+func anonymizeReport(report *opsgenie.Report, pseudonyms map[string]string) *opsgenie.Report {
+	anonymized := *report
+	anonymized.People = make(map[string]*opsgenie.PersonData, len(report.People))
+	for name, pdata := range report.People {
+		copied := *pdata
+		copied.Name = pseudonym(pseudonyms, name)
+		anonymized.People[copied.Name] = &copied
+	}
+	anonymized.Overlaps = make([]opsgenie.Overlap, len(report.Overlaps))
+	for i, overlap := range report.Overlaps {
+		overlap.People = anonymizeNames(overlap.People, pseudonyms)
+		anonymized.Overlaps[i] = overlap
+	}
+	anonymized.ExcludedHours = make(map[string]float64, len(report.ExcludedHours))
+	for name, hours := range report.ExcludedHours {
+		anonymized.ExcludedHours[pseudonym(pseudonyms, name)] = hours
+	}
+	return &anonymized
+}
+
+// anonymizeNames replaces names with their pseudonyms, sorted
+func anonymizeNames(names []string, pseudonyms map[string]string) []string {
+	anonymized := make([]string, len(names))
+	for i, name := range names {
+		anonymized[i] = pseudonym(pseudonyms, name)
+	}
+	sort.Strings(anonymized)
+	return anonymized
+}
+
+// writePseudonymMap writes pseudonym,name CSV rows in pseudonym order, for -anonymize-map
+func writePseudonymMap(w io.Writer, pseudonyms map[string]string) error {
+	names := make([]string, 0, len(pseudonyms))
+	for name := range pseudonyms {
+		names = append(names, name)
+	}
+	// Longer pseudonyms come later: Person Z before Person AA
+	sort.Slice(names, func(i, j int) bool {
+		a, b := pseudonyms[names[i]], pseudonyms[names[j]]
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return a < b
+	})
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"pseudonym", "name"})
+	for _, name := range names {
+		out.Write([]string{pseudonyms[name], name})
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// checkpointVersion is bumped whenever the checkpoint file layout changes incompatibly
+const checkpointVersion = 1
+
+// checkpointInterval is the minimum time between two checkpoint writes; the state after
+// each finished schedule is always written
+const checkpointInterval = 5 * time.Second
+
+// checkpointFile is the on-disk state of an interrupted oncall run, one entry per schedule
+type checkpointFile struct {
+	Version   int                             `json:"version"`
+	TZ        string                          `json:"tz"` // -tz the daily hours are bucketed in
+	Schedules map[string]*opsgenie.Checkpoint `json:"schedules"`
+}
+
+// checkpointWriter persists report progress to path while the report runs. record is
+// safe to call from concurrently running schedule reports.
+type checkpointWriter struct {
+	mu        sync.Mutex
+	path      string
+	state     checkpointFile
+	lastWrite time.Time
+}
+
+// newCheckpointWriter starts an empty checkpoint at path, replacing any earlier one on the
+// first write
+func newCheckpointWriter(path, tz string) *checkpointWriter {
+	return &checkpointWriter{
+		path:  path,
+		state: checkpointFile{Version: checkpointVersion, TZ: tz, Schedules: make(map[string]*opsgenie.Checkpoint)},
+	}
+}
+
+// loadCheckpoint reads the checkpoint file at path. A missing file yields an empty state,
+// so -resume on a run that never checkpointed simply starts from the beginning.
+func loadCheckpoint(path, tz string) (*checkpointWriter, error) {
+	writer := newCheckpointWriter(path, tz)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("No checkpoint at %s; starting from the beginning", path)
+		return writer, nil
+	}
+	if err != nil {
+		return nil, validationError("cannot read checkpoint: %v", err)
+	}
+	var state checkpointFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, validationError("invalid checkpoint %s: %v", path, err)
+	}
+	if state.Version != checkpointVersion {
+		return nil, validationError("checkpoint %s has version %d, expected %d", path, state.Version, checkpointVersion)
+	}
+	if state.TZ != tz {
+		return nil, validationError("checkpoint %s was taken with -tz %s; rerun with the same -tz or remove it", path, state.TZ)
+	}
+	if state.Schedules != nil {
+		writer.state.Schedules = state.Schedules
+	}
+	return writer, nil
+}
+
+// resume returns the checkpoint of a schedule, or nil when it has not been started. It
+// fails when the checkpoint was taken for a different range or mode.
+func (w *checkpointWriter) resume(scheduleID string, start, end time.Time, exact bool) (*opsgenie.Checkpoint, error) {
+	checkpoint, ok := w.state.Schedules[scheduleID]
+	if !ok {
+		return nil, nil
+	}
+	if !checkpoint.Start.Equal(start) || !checkpoint.End.Equal(end) || checkpoint.Exact != exact {
+		return nil, validationError("checkpoint %s was taken for schedule %s from %s to %s (exact: %t); rerun with the same -start, -end and -exact or remove it",
+			w.path, scheduleID, checkpoint.Start.Format(time.RFC3339), checkpoint.End.Format(time.RFC3339), checkpoint.Exact)
+	}
+	return checkpoint, nil
+}
+
+// record stores the latest checkpoint of a schedule and writes the file when
+// checkpointInterval has passed or the schedule is complete. Write failures are logged
+// rather than aborting the report.
+func (w *checkpointWriter) record(checkpoint opsgenie.Checkpoint) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state.Schedules[checkpoint.ScheduleID] = &checkpoint
+	if time.Since(w.lastWrite) < checkpointInterval && checkpoint.Next.Before(checkpoint.End) {
+		return
+	}
+	if err := w.write(); err != nil {
+		log.Printf("Failed to write checkpoint: %v", err)
+	}
+}
+
+func (w *checkpointWriter) write() error {
+	var encodeErr error
+	err := writeFileAtomically(w.path, func(out io.Writer) {
+		encodeErr = json.NewEncoder(out).Encode(w.state)
+	})
+	if err == nil && encodeErr != nil {
+		err = fmt.Errorf("failed to encode checkpoint: %w", encodeErr)
+	}
+	if err == nil {
+		w.lastWrite = time.Now()
+	}
+	return err
+}
+
+// remove deletes the checkpoint file once the report has completed
+func (w *checkpointWriter) remove() {
+	if err := os.Remove(w.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to remove checkpoint: %v", err)
+	}
+}
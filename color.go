@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"os"
+)
+
+// ANSI escape sequences for the few colors terminal output uses
+const (
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiReset  = "\033[0m"
+)
+
+func addColorFlag(fs *flag.FlagSet) *string {
+	return fs.String("color", "auto", "Colorize output: auto (only on a terminal, and not when NO_COLOR is set), always or never")
+}
+
+// palette colors text for the terminal; the zero value leaves text unchanged
+type palette struct {
+	enabled bool
+}
+
+// newPalette resolves a -color value. auto follows the NO_COLOR convention (https://no-color.org)
+// and disables color when stdout is not a terminal, so redirected output never carries escape
+// codes; always and never override both.
+func newPalette(mode string) (palette, error) {
+	switch mode {
+	case "always":
+		return palette{enabled: true}, nil
+	case "never":
+		return palette{}, nil
+	case "auto":
+		return palette{enabled: os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && stdoutIsTerminal()}, nil
+	default:
+		return palette{}, validationError("invalid -color value %q (expected auto, always or never)", mode)
+	}
+}
+
+func (p palette) paint(color, text string) string {
+	if !p.enabled || color == "" || text == "" {
+		return text
+	}
+	return color + text + ansiReset
+}
+
+func (p palette) red(text string) string   { return p.paint(ansiRed, text) }
+func (p palette) green(text string) string { return p.paint(ansiGreen, text) }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// contactBook fetches and caches the contact methods of on-call people for -contacts, so
+// -watch only looks up people who newly came on call
+type contactBook struct {
+	client   *opsgenie.Client
+	contacts map[string][]opsgenie.Contact // username -> enabled contact methods
+}
+
+func newContactBook(client *opsgenie.Client) *contactBook {
+	return &contactBook{client: client, contacts: make(map[string][]opsgenie.Contact)}
+}
+
+// lookup returns the enabled contact methods of everyone currently on call in statuses.
+// People whose contacts cannot be fetched are logged and left out.
+func (b *contactBook) lookup(statuses []*opsgenie.ScheduleStatus) map[string][]opsgenie.Contact {
+	found := make(map[string][]opsgenie.Contact)
+	for _, entry := range opsgenie.Roster(statuses) {
+		contacts, ok := b.contacts[entry.Name]
+		if !ok {
+			all, err := b.client.UserContacts(entry.Name)
+			if err != nil {
+				if opsgenie.KindOf(err) == opsgenie.KindAuth {
+					log.Printf("Warning: %v (-contacts needs an API key with configuration access)", err)
+				} else {
+					log.Printf("Warning: %v", err)
+				}
+				continue
+			}
+			for _, contact := range all {
+				if contact.Status.Enabled {
+					contacts = append(contacts, contact)
+				}
+			}
+			b.contacts[entry.Name] = contacts
+		}
+		found[entry.Name] = contacts
+	}
+	return found
+}
+
+// printContacts lists how to reach each person, after the schedule table or roster
+func printContacts(contacts map[string][]opsgenie.Contact) {
+	names := make([]string, 0, len(contacts))
+	for name := range contacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Println("\nContacts")
+	fmt.Println(strings.Repeat("=", 140))
+	for _, name := range names {
+		methods := make([]string, 0, len(contacts[name]))
+		for _, contact := range contacts[name] {
+			methods = append(methods, contact.Method+" "+contact.To)
+		}
+		if len(methods) == 0 {
+			methods = append(methods, "(no enabled contact methods)")
+		}
+		fmt.Printf("%s %s\n", padRight(truncate(name, 40), 40), strings.Join(methods, ", "))
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// runDoctorCommand checks the setup step by step (API key, region, schedule access, rate
+// limit) and prints one line per check, so a broken setup shows exactly which step fails.
+// It returns the first failure, which sets the exit code.
+func runDoctorCommand(args []string) error {
+	doctorFlags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	colorFlag := addColorFlag(doctorFlags)
+	clientOpts := addClientFlags(doctorFlags)
+	doctorFlags.Parse(args)
+
+	colors, err := newPalette(*colorFlag)
+	if err != nil {
+		return err
+	}
+
+	_, source, err := clientOpts.resolveAPIKey()
+	if err != nil {
+		printCheck(colors, false, "API key: %v", err)
+		printSkipped("region", "can list schedules", "rate-limit headroom")
+		return err
+	}
+	printCheck(colors, true, "API key found (%s)", source)
+
+	client, cleanup, err := clientOpts.newClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	initialBaseURL := client.BaseURL
+	schedules, err := client.Schedules()
+	if err != nil {
+		// Without a successful request the region is unknown, so the failure is reported there
+		switch {
+		case opsgenie.KindOf(err) == opsgenie.KindAuth:
+			printCheck(colors, false, "region: API key rejected (tried the US and EU instances): %v", err)
+		case errors.Is(err, opsgenie.ErrCircuitOpen) || opsgenie.KindOf(err) == opsgenie.KindNetwork:
+			printCheck(colors, false, "region: cannot reach %s: %v", client.BaseURL, err)
+		default:
+			printCheck(colors, false, "region: %v", err)
+		}
+		printSkipped("can list schedules", "rate-limit headroom")
+		return err
+	}
+	region := regionName(client.BaseURL)
+	if client.BaseURL != initialBaseURL {
+		region += ", detected after the key was rejected by " + regionName(initialBaseURL)
+	}
+	printCheck(colors, true, "region: %s", region)
+	printCheck(colors, len(schedules) > 0, "can list schedules (%d found)", len(schedules))
+	if len(schedules) == 0 {
+		err = &opsgenie.Error{Kind: opsgenie.KindAuth, Err: errors.New("the API key cannot see any schedules; check its access rights")}
+		printSkipped("rate-limit headroom")
+		return err
+	}
+
+	switch state := client.RateLimitState(); state {
+	case "THROTTLED":
+		printCheck(colors, false, "rate-limit headroom: OpsGenie reports the account as throttled; wait before running reports")
+		return &opsgenie.Error{Kind: opsgenie.KindNetwork, Err: errors.New("rate limited by OpsGenie")}
+	case "":
+		printCheck(colors, true, "rate-limit headroom (no rate-limit state reported)")
+	default:
+		printCheck(colors, true, "rate-limit headroom (state %s)", state)
+	}
+	return nil
+}
+
+func printCheck(colors palette, ok bool, format string, args ...any) {
+	mark := colors.green("✓")
+	if !ok {
+		mark = colors.red("✗")
+	}
+	fmt.Printf("%s %s\n", mark, fmt.Sprintf(format, args...))
+}
+
+func printSkipped(checks ...string) {
+	for _, check := range checks {
+		fmt.Printf("- %s (skipped)\n", check)
+	}
+}
+
+// regionName describes an API base URL as its OpsGenie region
+func regionName(baseURL string) string {
+	switch baseURL {
+	case opsgenie.DefaultBaseURL:
+		return "US (" + baseURL + ")"
+	case opsgenie.EUBaseURL:
+		return "EU (" + baseURL + ")"
+	default:
+		return baseURL
+	}
+}
@@ -1,5 +1,3 @@
 module github.com/scor2k/opsgenie-on-call
 
 go 1.22.3
-
-require golang.org/x/exp v0.0.0-20241217172543-b2144cdd0a67
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// Grafana Simple JSON datasource metrics, one target per schedule and metric named
+// "<schedule name>/<metric>"
+const (
+	grafanaHasOnCall   = "has_oncall"
+	grafanaShiftEndsIn = "shift_ends_in_seconds"
+)
+
+// grafanaMaxDataPoints caps the points of one series when Grafana does not ask for fewer
+const grafanaMaxDataPoints = 1000
+
+// grafanaServer answers the Grafana Simple JSON datasource protocol for schedules with
+// timeseries of whether anyone is on call and how long until the shift ends, computed from
+// each schedule's timeline over the queried range
+type grafanaServer struct {
+	client    *opsgenie.Client
+	schedules []opsgenie.Schedule
+}
+
+// grafanaQuery is the body of a /query request
+type grafanaQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	IntervalMs    int64 `json:"intervalMs"`
+	MaxDataPoints int   `json:"maxDataPoints"`
+	Targets       []struct {
+		Target string `json:"target"`
+	} `json:"targets"`
+}
+
+// grafanaSeries is one timeseries of a /query response; each datapoint is [value, unix ms]
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// serveGrafana serves the Simple JSON datasource on addr until the process is interrupted
+func serveGrafana(addr string, client *opsgenie.Client, schedules []opsgenie.Schedule) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           (&grafanaServer{client: client, schedules: schedules}).handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	log.Printf("Serving the Grafana Simple JSON datasource for %d schedules on %s", len(schedules), addr)
+	if err := server.ListenAndServe(); err != nil {
+		return validationError("-listen %s: %v", addr, err)
+	}
+	return nil
+}
+
+func (s *grafanaServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	// Grafana's "Test" button expects a 200 from the root
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK\n"))
+	})
+	mux.HandleFunc("POST /search", s.search)
+	mux.HandleFunc("POST /query", s.query)
+	return mux
+}
+
+// search lists the targets whose name contains the request's target, ignoring case
+func (s *grafanaServer) search(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Target string `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid search request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	targets := []string{}
+	for _, schedule := range s.schedules {
+		for _, metric := range []string{grafanaHasOnCall, grafanaShiftEndsIn} {
+			target := schedule.Name + "/" + metric
+			if strings.Contains(strings.ToLower(target), strings.ToLower(req.Target)) {
+				targets = append(targets, target)
+			}
+		}
+	}
+	sort.Strings(targets)
+	writeGrafanaJSON(w, targets)
+}
+
+// query returns a series for every requested target, sampled from the range start at the
+// request's interval (at least a minute, and coarser if needed to stay within the maximum
+// number of points). Each schedule's timeline is fetched once per request.
+func (s *grafanaServer) query(w http.ResponseWriter, r *http.Request) {
+	var req grafanaQuery
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid query request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, to := req.Range.From.UTC(), req.Range.To.UTC()
+	if !to.After(from) {
+		http.Error(w, "invalid query range: to must be after from", http.StatusBadRequest)
+		return
+	}
+	step := max(time.Duration(req.IntervalMs)*time.Millisecond, time.Minute)
+	maxPoints := req.MaxDataPoints
+	if maxPoints <= 0 || maxPoints > grafanaMaxDataPoints {
+		maxPoints = grafanaMaxDataPoints
+	}
+	step = max(step, to.Sub(from)/time.Duration(maxPoints))
+
+	shifts := make(map[string][]opsgenie.Shift)
+	series := []grafanaSeries{}
+	for _, t := range req.Targets {
+		schedule, metric, ok := s.target(t.Target)
+		if !ok {
+			http.Error(w, "unknown target "+t.Target, http.StatusBadRequest)
+			return
+		}
+		scheduleShifts, fetched := shifts[schedule.ID]
+		if !fetched {
+			var err error
+			if scheduleShifts, err = s.client.Shifts(schedule.ID, from, to, s.client.Rotation); err != nil {
+				log.Printf("Warning: Failed to fetch the timeline of schedule %s for Grafana: %v", schedule.Name, err)
+				http.Error(w, "failed to fetch the timeline of "+schedule.Name+": "+err.Error(), http.StatusBadGateway)
+				return
+			}
+			shifts[schedule.ID] = scheduleShifts
+		}
+		out := grafanaSeries{Target: t.Target, Datapoints: [][2]float64{}}
+		for at := from; !at.After(to); at = at.Add(step) {
+			shiftEnd, onCall := currentShiftEnd(scheduleShifts, at)
+			ms := float64(at.UnixMilli())
+			switch {
+			case metric == grafanaHasOnCall:
+				out.Datapoints = append(out.Datapoints, [2]float64{float64(boolToInt(onCall)), ms})
+			case onCall:
+				out.Datapoints = append(out.Datapoints, [2]float64{shiftEnd.Sub(at).Seconds(), ms})
+			}
+		}
+		series = append(series, out)
+	}
+	writeGrafanaJSON(w, series)
+}
+
+// target resolves a "<schedule name>/<metric>" target; schedule names may contain slashes
+func (s *grafanaServer) target(target string) (opsgenie.Schedule, string, bool) {
+	i := strings.LastIndex(target, "/")
+	if i < 0 {
+		return opsgenie.Schedule{}, "", false
+	}
+	name, metric := target[:i], target[i+1:]
+	if metric != grafanaHasOnCall && metric != grafanaShiftEndsIn {
+		return opsgenie.Schedule{}, "", false
+	}
+	for _, schedule := range s.schedules {
+		if schedule.Name == name {
+			return schedule, metric, true
+		}
+	}
+	return opsgenie.Schedule{}, "", false
+}
+
+// currentShiftEnd returns the earliest end of the shifts covering at, and whether any does
+func currentShiftEnd(shifts []opsgenie.Shift, at time.Time) (time.Time, bool) {
+	var end time.Time
+	for _, shift := range shifts {
+		if !shift.Start.After(at) && shift.End.After(at) && (end.IsZero() || shift.End.Before(end)) {
+			end = shift.End
+		}
+	}
+	return end, !end.IsZero()
+}
+
+func writeGrafanaJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Warning: Failed to write Grafana response: %v", err)
+	}
+}
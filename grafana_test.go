@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+func newGrafanaTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	day := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	periods := map[string][][2]time.Time{"s1": {{day, day.Add(8 * time.Hour)}}}
+	client := scheduleTimelines(t, periods, map[string]string{"s1": "alice"}, 0)
+	schedules := []opsgenie.Schedule{{ID: "s1", Name: "Prod/EU"}, {ID: "s2", Name: "Staging"}}
+	srv := httptest.NewServer((&grafanaServer{client: client, schedules: schedules}).handler())
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func postGrafana(t *testing.T, srv *httptest.Server, path, body string, out any) int {
+	t.Helper()
+	resp, err := http.Post(srv.URL+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK && out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestGrafanaSearch(t *testing.T) {
+	srv := newGrafanaTestServer(t)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Prod/EU/has_oncall", "Prod/EU/shift_ends_in_seconds", "Staging/has_oncall", "Staging/shift_ends_in_seconds"}},
+		{"prod", []string{"Prod/EU/has_oncall", "Prod/EU/shift_ends_in_seconds"}},
+		{"nothing", []string{}},
+	}
+	for _, tt := range tests {
+		var got []string
+		if status := postGrafana(t, srv, "/search", `{"target":"`+tt.query+`"}`, &got); status != http.StatusOK {
+			t.Fatalf("search %q: status %d", tt.query, status)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("search %q = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestGrafanaQuery(t *testing.T) {
+	srv := newGrafanaTestServer(t)
+	// Hourly points from 06:00 to 10:00; alice is on call until 08:00
+	body := `{"range":{"from":"2025-01-06T06:00:00Z","to":"2025-01-06T10:00:00Z"},"intervalMs":3600000,
+		"targets":[{"target":"Prod/EU/has_oncall"},{"target":"Prod/EU/shift_ends_in_seconds"}]}`
+	var got []grafanaSeries
+	if status := postGrafana(t, srv, "/query", body, &got); status != http.StatusOK {
+		t.Fatalf("query: status %d", status)
+	}
+	ms := func(hour int) float64 {
+		return float64(time.Date(2025, 1, 6, hour, 0, 0, 0, time.UTC).UnixMilli())
+	}
+	want := []grafanaSeries{
+		{"Prod/EU/has_oncall", [][2]float64{{1, ms(6)}, {1, ms(7)}, {0, ms(8)}, {0, ms(9)}, {0, ms(10)}}},
+		{"Prod/EU/shift_ends_in_seconds", [][2]float64{{7200, ms(6)}, {3600, ms(7)}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("query = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{
+		`{"range":{"from":"2025-01-06T06:00:00Z","to":"2025-01-06T10:00:00Z"},"targets":[{"target":"Prod/EU/unknown"}]}`,
+		`{"range":{"from":"2025-01-06T10:00:00Z","to":"2025-01-06T06:00:00Z"},"targets":[{"target":"Prod/EU/has_oncall"}]}`,
+		`not json`,
+	} {
+		if status := postGrafana(t, srv, "/query", bad, nil); status != http.StatusBadRequest {
+			t.Errorf("query %s: status %d, want %d", bad, status, http.StatusBadRequest)
+		}
+	}
+	// The timeline of Staging cannot be fetched
+	staging := `{"range":{"from":"2025-01-06T06:00:00Z","to":"2025-01-06T10:00:00Z"},"targets":[{"target":"Staging/has_oncall"}]}`
+	if status := postGrafana(t, srv, "/query", staging, nil); status != http.StatusBadGateway {
+		t.Errorf("query of a failing schedule: status %d, want %d", status, http.StatusBadGateway)
+	}
+}
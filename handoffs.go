@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+func runHandoffsCommand(args []string) error {
+	handoffsFlags := flag.NewFlagSet("handoffs", flag.ExitOnError)
+	startDateStr := handoffsFlags.String("start", "", "Start date (YYYY-MM-DD), or time (YYYY-MM-DD HH:MM or RFC3339)")
+	endDateStr := handoffsFlags.String("end", "", "End date (YYYY-MM-DD, inclusive), or exclusive end time (YYYY-MM-DD HH:MM or RFC3339)")
+	scheduleID := handoffsFlags.String("schedule", "", "OpsGenie Schedule ID (UUID)")
+	rotation := handoffsFlags.String("rotation", "", "Only follow one rotation (ID, name or 1-based position)")
+	format := handoffsFlags.String("format", "auto", "Output format: auto (table on a terminal, json when piped), table, json")
+	jsonIndent := addJSONIndentFlag(handoffsFlags)
+	dateFormat := addDateFormatFlag(handoffsFlags)
+
+	clientOpts := addClientFlags(handoffsFlags)
+
+	handoffsFlags.Parse(args)
+
+	if *startDateStr == "" || *endDateStr == "" || *scheduleID == "" {
+		return validationError("start date, end date, and schedule ID must be provided")
+	}
+	*format = resolveFormat(*format, false)
+	switch *format {
+	case "table", "json":
+	default:
+		return validationError("invalid -format value %q (expected auto, table or json)", *format)
+	}
+
+	startDate, _, err := parseRangeTime(*startDateStr)
+	if err != nil {
+		return validationError("invalid start date format: %v", err)
+	}
+	endDate, endHasTime, err := parseRangeTime(*endDateStr)
+	if err != nil {
+		return validationError("invalid end date format: %v", err)
+	}
+	rangeEnd := endDate
+	if !endHasTime {
+		rangeEnd = endDate.AddDate(0, 0, 1)
+	}
+	if !rangeEnd.After(startDate) {
+		return validationError("end must be after start")
+	}
+
+	client, cleanup, err := clientOpts.newClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	handoffs, err := client.Handoffs(*scheduleID, startDate, rangeEnd, *rotation)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		return writeJSON(os.Stdout, newHandoffsJSON(*scheduleID, startDate, rangeEnd, handoffs), *jsonIndent)
+	}
+	dates := humanDates{layout: *dateFormat}
+	if len(handoffs) == 0 {
+		fmt.Println("No handoffs in the range.")
+		return nil
+	}
+	for _, handoff := range handoffs {
+		fmt.Printf("%s — %s\n", dates.time(handoff.At), describeHandoff(handoff))
+	}
+	return nil
+}
+
+// describeHandoff phrases a handoff for the table, e.g. "Alice handed off to Bob"
+func describeHandoff(handoff opsgenie.Handoff) string {
+	from, to := strings.Join(handoff.From, ", "), strings.Join(handoff.To, ", ")
+	left, joined := difference(handoff.From, handoff.To), difference(handoff.To, handoff.From)
+	switch {
+	case from == "":
+		return to + " took over (coverage gap ends)"
+	case to == "":
+		return from + " went off call (coverage gap starts)"
+	case len(left) == 0:
+		// Overlapping shifts: someone joins without anyone leaving
+		return strings.Join(joined, ", ") + " joined " + from
+	case len(joined) == 0:
+		return strings.Join(left, ", ") + " went off call, leaving " + to
+	default:
+		return from + " handed off to " + to
+	}
+}
+
+// difference returns the values of a missing from b
+func difference(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, value := range b {
+		inB[value] = true
+	}
+	var missing []string
+	for _, value := range a {
+		if !inB[value] {
+			missing = append(missing, value)
+		}
+	}
+	return missing
+}
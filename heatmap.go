@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// heatmapShades are the heatmap cells for 0, under 6, under 12, under 18 and 18 or more
+// on-call hours in a day
+var heatmapShades = []byte{' ', '.', '-', '+', '#'}
+
+func heatmapShade(hours float64) byte {
+	if hours <= 0 {
+		return heatmapShades[0]
+	}
+	index := 1 + int(hours/6)
+	if index >= len(heatmapShades) {
+		index = len(heatmapShades) - 1
+	}
+	return heatmapShades[index]
+}
+
+// writeHeatmap prints one row per person and one column per day of the report (in its
+// Location), shaded by how many hours of that day the person was on call
+func writeHeatmap(w io.Writer, report *opsgenie.Report, dates humanDates) {
+	days := report.Days()
+	if len(days) == 0 {
+		return
+	}
+
+	var names []string
+	for name := range report.People {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "\nOn-Call Heatmap (one column per day, %s to %s)\n",
+		dates.date(days[0]), dates.date(days[len(days)-1]))
+	var tens, units strings.Builder
+	for _, day := range days {
+		tens.WriteByte(byte('0' + day.Day()/10))
+		units.WriteByte(byte('0' + day.Day()%10))
+	}
+	fmt.Fprintf(w, "%-40s %s\n", "Day", tens.String())
+	fmt.Fprintf(w, "%-40s %s\n", "", units.String())
+	fmt.Fprintln(w, strings.Repeat("-", 41+len(days)))
+
+	for _, name := range names {
+		pdata := report.People[name]
+		var row strings.Builder
+		for _, day := range days {
+			row.WriteByte(heatmapShade(pdata.DailyHours[day.UTC()]))
+		}
+		fmt.Fprintf(w, "%s %s\n", padRight(truncate(name, 40), 40), row.String())
+	}
+	fmt.Fprintln(w, "\nLegend: ' ' none, '.' <6h, '-' <12h, '+' <18h, '#' 18h or more")
+}
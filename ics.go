@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// runICSCommand writes the on-call shifts of a schedule as an iCalendar file, one event per
+// shift, for subscribing to or importing into a calendar
+func runICSCommand(args []string) error {
+	icsFlags := flag.NewFlagSet("ics", flag.ExitOnError)
+	startDateStr := icsFlags.String("start", "", "Start date (YYYY-MM-DD), or time (YYYY-MM-DD HH:MM or RFC3339)")
+	endDateStr := icsFlags.String("end", "", "End date (YYYY-MM-DD, inclusive), or exclusive end time (YYYY-MM-DD HH:MM or RFC3339)")
+	scheduleID := icsFlags.String("schedule", "", "OpsGenie Schedule ID (UUID)")
+	rotation := icsFlags.String("rotation", "", "Only include one rotation (ID, name or 1-based position)")
+	person := icsFlags.String("person", "", "Only include this person's shifts (username or email, case-insensitive)")
+	output := icsFlags.String("output", "", "Write the calendar to this file, atomically, instead of stdout")
+
+	clientOpts := addClientFlags(icsFlags)
+
+	icsFlags.Parse(args)
+
+	if *startDateStr == "" || *endDateStr == "" || *scheduleID == "" {
+		return validationError("start date, end date, and schedule ID must be provided")
+	}
+
+	startDate, _, err := parseRangeTime(*startDateStr)
+	if err != nil {
+		return validationError("invalid start date format: %v", err)
+	}
+	endDate, endHasTime, err := parseRangeTime(*endDateStr)
+	if err != nil {
+		return validationError("invalid end date format: %v", err)
+	}
+	rangeEnd := endDate
+	if !endHasTime {
+		rangeEnd = endDate.AddDate(0, 0, 1)
+	}
+	if !rangeEnd.After(startDate) {
+		return validationError("end must be after start")
+	}
+
+	client, cleanup, err := clientOpts.newClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	shifts, err := client.Shifts(*scheduleID, startDate, rangeEnd, *rotation)
+	if err != nil {
+		return err
+	}
+	if *person != "" {
+		var matched []opsgenie.Shift
+		for _, shift := range shifts {
+			if matchesPerson(shift.Person, *person) {
+				matched = append(matched, shift)
+			}
+		}
+		shifts = matched
+	}
+
+	if *output == "" {
+		return writeICS(os.Stdout, *scheduleID, shifts, time.Now().UTC())
+	}
+	var writeErr error
+	err = writeFileAtomically(*output, func(w io.Writer) {
+		writeErr = writeICS(w, *scheduleID, shifts, time.Now().UTC())
+	})
+	if err == nil {
+		err = writeErr
+	}
+	return err
+}
+
+// matchesPerson reports whether recipient is person, ignoring case and, when person has no
+// domain, the recipient's email domain
+func matchesPerson(recipient, person string) bool {
+	person = strings.TrimSpace(person)
+	if strings.EqualFold(recipient, person) {
+		return true
+	}
+	at := strings.LastIndex(recipient, "@")
+	return !strings.Contains(person, "@") && at > 0 && strings.EqualFold(recipient[:at], person)
+}
+
+// icsTimeLayout is the iCalendar UTC date-time format (RFC 5545 section 3.3.5)
+const icsTimeLayout = "20060102T150405Z"
+
+// writeICS renders shifts as an iCalendar document with CRLF line endings; stamp is the
+// DTSTAMP of every event. UIDs are derived from the schedule, person and start, so
+// re-exporting updates events in place instead of duplicating them.
+func writeICS(w io.Writer, scheduleID string, shifts []opsgenie.Shift, stamp time.Time) error {
+	buf := bufio.NewWriter(w)
+	line := func(content string) {
+		buf.WriteString(foldICSLine(content))
+		buf.WriteString("\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//scor2k//opsgenie-on-call//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + escapeICSText("On-call "+scheduleID))
+	for _, shift := range shifts {
+		uid := sha1.Sum([]byte(scheduleID + "\x00" + shift.Person + "\x00" + shift.Start.Format(time.RFC3339)))
+		line("BEGIN:VEVENT")
+		line("UID:" + hex.EncodeToString(uid[:]) + "@opsgenie-on-call")
+		line("DTSTAMP:" + stamp.UTC().Format(icsTimeLayout))
+		line("DTSTART:" + shift.Start.UTC().Format(icsTimeLayout))
+		line("DTEND:" + shift.End.UTC().Format(icsTimeLayout))
+		line("SUMMARY:" + escapeICSText("On-call: "+shift.Person))
+		line("DESCRIPTION:" + escapeICSText("OpsGenie schedule "+scheduleID))
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return buf.Flush()
+}
+
+// escapeICSText escapes a TEXT property value (RFC 5545 section 3.3.11)
+func escapeICSText(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
+
+// foldICSLine splits a content line into lines of at most 75 octets, continued with a
+// leading space, without cutting a UTF-8 sequence (RFC 5545 section 3.1)
+func foldICSLine(content string) string {
+	var folded strings.Builder
+	width := 0
+	for _, r := range content {
+		size := len(string(r))
+		if width+size > 75 {
+			folded.WriteString("\r\n ")
+			width = 1
+		}
+		folded.WriteRune(r)
+		width += size
+	}
+	return folded.String()
+}
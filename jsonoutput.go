@@ -0,0 +1,545 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// jsonSchemaVersion is included as "schemaVersion" in every JSON document the tool emits.
+// Adding fields keeps the version; removing, renaming or retyping a field bumps it. The
+// schemas printed by the json-schema command must be kept in sync with these structs.
+const jsonSchemaVersion = 1
+
+type reportJSON struct {
+	SchemaVersion int                `json:"schemaVersion"`
+	ScheduleID    string             `json:"scheduleId"`
+	Start         string             `json:"start"`
+	End           string             `json:"end"`
+	Ranges        []rangeJSON        `json:"ranges,omitempty"` // only with several -ranges
+	People        []personJSON       `json:"people"`
+	TotalHours    float64            `json:"totalHours"`
+	TotalDays     float64            `json:"totalDays"`
+	TotalWeeks    float64            `json:"totalWeeks"`
+	Coverage      float64            `json:"coveragePercent"`         // share of the range with someone on call
+	TotalCost     *float64           `json:"totalCost,omitempty"`     // only with -hourly-rate
+	ExcludedHours map[string]float64 `json:"excludedHours,omitempty"` // hours per -exclude-person match
+	Teams         []teamJSON         `json:"teams,omitempty"`         // only with -by-team
+	Schedules     []reportJSON       `json:"schedules,omitempty"`     // per-schedule sections, only with -by-schedule
+}
+
+// rangeJSON is one of the ranges a report over several -ranges covers
+type rangeJSON struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+type teamJSON struct {
+	Name          string   `json:"name"`
+	Hours         float64  `json:"hours"`
+	BusinessHours float64  `json:"businessHours"`
+	OffHours      float64  `json:"offHours"`
+	People        []string `json:"people"`
+}
+
+// reportSummaryJSON is reportJSON without the per-person breakdown, for -summary-only
+type reportSummaryJSON struct {
+	SchemaVersion int                 `json:"schemaVersion"`
+	ScheduleID    string              `json:"scheduleId"`
+	Start         string              `json:"start"`
+	End           string              `json:"end"`
+	Ranges        []rangeJSON         `json:"ranges,omitempty"` // only with several -ranges
+	TotalHours    float64             `json:"totalHours"`
+	TotalDays     float64             `json:"totalDays"`
+	TotalWeeks    float64             `json:"totalWeeks"`
+	Coverage      float64             `json:"coveragePercent"`         // share of the range with someone on call
+	TotalCost     *float64            `json:"totalCost,omitempty"`     // only with -hourly-rate
+	ExcludedHours map[string]float64  `json:"excludedHours,omitempty"` // hours per -exclude-person match
+	Teams         []teamJSON          `json:"teams,omitempty"`         // only with -by-team
+	Schedules     []reportSummaryJSON `json:"schedules,omitempty"`     // per-schedule sections, only with -by-schedule
+}
+
+type personJSON struct {
+	Name          string   `json:"name"`
+	Hours         float64  `json:"hours"`
+	BusinessHours float64  `json:"businessHours"`
+	OffHours      float64  `json:"offHours"`
+	Cost          *float64 `json:"cost,omitempty"`          // only with -hourly-rate
+	FTE           *float64 `json:"fte,omitempty"`           // share of the range on call, only with -load
+	CoverageWeeks *float64 `json:"coverageWeeks,omitempty"` // hours in weeks of 24/7 coverage, only with -load
+}
+
+type statusesJSON struct {
+	SchemaVersion int                      `json:"schemaVersion"`
+	At            string                   `json:"at"`
+	Schedules     []statusJSON             `json:"schedules"`
+	Contacts      map[string][]contactJSON `json:"contacts,omitempty"` // only with -contacts
+}
+
+type contactJSON struct {
+	Method string `json:"method"`
+	To     string `json:"to"`
+}
+
+// newContactsJSON converts -contacts lookups; nil (no -contacts) stays nil so the field is omitted
+func newContactsJSON(contacts map[string][]opsgenie.Contact) map[string][]contactJSON {
+	if contacts == nil {
+		return nil
+	}
+	out := make(map[string][]contactJSON, len(contacts))
+	for name, methods := range contacts {
+		out[name] = []contactJSON{}
+		for _, contact := range methods {
+			out[name] = append(out[name], contactJSON{Method: contact.Method, To: contact.To})
+		}
+	}
+	return out
+}
+
+type statusJSON struct {
+	ScheduleID        string   `json:"scheduleId"`
+	ScheduleName      string   `json:"scheduleName"`
+	Timezone          string   `json:"timezone,omitempty"`
+	CurrentOnCall     []string `json:"currentOnCall"`
+	NextOnCall        []string `json:"nextOnCall"`
+	ShiftEndsAt       string   `json:"shiftEndsAt,omitempty"`
+	ShiftEndsSoon     bool     `json:"shiftEndsSoon"`
+	CoverageGap       bool     `json:"coverageGap"`
+	NoSuccessor       bool     `json:"noSuccessor"`
+	Disabled          bool     `json:"disabled"`
+	NextShiftStartsAt string   `json:"nextShiftStartsAt,omitempty"` // only when no one is on call
+	Error             string   `json:"error,omitempty"`
+	ShiftError        string   `json:"shiftError,omitempty"`
+	Participants      []string `json:"participants,omitempty"` // only with -show-participants
+	ParticipantsError string   `json:"participantsError,omitempty"`
+}
+
+func newReportJSON(report *opsgenie.Report, totalHours float64, costs costEstimate, load bool, sortMode string) reportJSON {
+	out := reportJSON{
+		SchemaVersion: jsonSchemaVersion,
+		ScheduleID:    report.ScheduleID,
+		Start:         report.Start.Format(time.RFC3339),
+		End:           report.End.Format(time.RFC3339),
+		People:        []personJSON{},
+		TotalHours:    totalHours,
+		TotalDays:     totalHours / 24,
+		TotalWeeks:    totalHours / 24 / 7,
+		Coverage:      report.Coverage(),
+	}
+	for _, segment := range report.Segments {
+		out.Ranges = append(out.Ranges, rangeJSON{Start: segment.Start.Format(time.RFC3339), End: segment.End.Format(time.RFC3339)})
+	}
+	if len(report.ExcludedHours) > 0 {
+		out.ExcludedHours = report.ExcludedHours
+	}
+	var totalCost float64
+	for _, pdata := range sortedPeople(report, sortMode) {
+		person := personJSON{
+			Name:          pdata.Name,
+			Hours:         pdata.TotalHours,
+			BusinessHours: pdata.BusinessHours,
+			OffHours:      pdata.OffHours,
+		}
+		if costs.enabled() {
+			cost := costs.of(pdata)
+			totalCost += cost
+			person.Cost = &cost
+		}
+		if load {
+			share, weeks := fte(report, pdata.TotalHours), pdata.TotalHours/hoursPerWeek
+			person.FTE, person.CoverageWeeks = &share, &weeks
+		}
+		out.People = append(out.People, person)
+	}
+	if costs.enabled() {
+		out.TotalCost = &totalCost
+	}
+	return out
+}
+
+func newReportSummaryJSON(report reportJSON) reportSummaryJSON {
+	out := reportSummaryJSON{
+		SchemaVersion: report.SchemaVersion,
+		ScheduleID:    report.ScheduleID,
+		Start:         report.Start,
+		End:           report.End,
+		Ranges:        report.Ranges,
+		TotalHours:    report.TotalHours,
+		TotalDays:     report.TotalDays,
+		TotalWeeks:    report.TotalWeeks,
+		Coverage:      report.Coverage,
+		TotalCost:     report.TotalCost,
+		ExcludedHours: report.ExcludedHours,
+		Teams:         report.Teams,
+	}
+	for _, section := range report.Schedules {
+		out.Schedules = append(out.Schedules, newReportSummaryJSON(section))
+	}
+	return out
+}
+
+func newTeamsJSON(totals []teamTotal) []teamJSON {
+	var out []teamJSON
+	for _, total := range totals {
+		out = append(out, teamJSON{
+			Name:          total.Name,
+			Hours:         total.Hours,
+			BusinessHours: total.BusinessHours,
+			OffHours:      total.OffHours,
+			People:        total.People,
+		})
+	}
+	return out
+}
+
+type handoffsJSON struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	ScheduleID    string        `json:"scheduleId"`
+	Start         string        `json:"start"`
+	End           string        `json:"end"`
+	Handoffs      []handoffJSON `json:"handoffs"`
+}
+
+type handoffJSON struct {
+	At   string   `json:"at"`
+	From []string `json:"from"` // empty when a coverage gap ends
+	To   []string `json:"to"`   // empty when a coverage gap starts
+}
+
+func newHandoffsJSON(scheduleID string, start, end time.Time, handoffs []opsgenie.Handoff) handoffsJSON {
+	out := handoffsJSON{
+		SchemaVersion: jsonSchemaVersion,
+		ScheduleID:    scheduleID,
+		Start:         start.Format(time.RFC3339),
+		End:           end.Format(time.RFC3339),
+		Handoffs:      []handoffJSON{},
+	}
+	for _, handoff := range handoffs {
+		out.Handoffs = append(out.Handoffs, handoffJSON{
+			At:   handoff.At.Format(time.RFC3339),
+			From: nonNil(handoff.From),
+			To:   nonNil(handoff.To),
+		})
+	}
+	return out
+}
+
+type coverageJSON struct {
+	SchemaVersion  int                     `json:"schemaVersion"`
+	ScheduleID     string                  `json:"scheduleId"`
+	Start          string                  `json:"start"`
+	End            string                  `json:"end"`
+	Valid          bool                    `json:"valid"`
+	UncoveredHours float64                 `json:"uncoveredHours"` // total hours of the gaps
+	Violations     []coverageViolationJSON `json:"violations"`
+}
+
+type coverageViolationJSON struct {
+	Kind   string   `json:"kind"` // "gap" or "overlap"
+	Start  string   `json:"start"`
+	End    string   `json:"end"`
+	Hours  float64  `json:"hours"`
+	People []string `json:"people"` // empty for a gap
+}
+
+func newCoverageJSON(scheduleID string, start, end time.Time, violations []opsgenie.CoverageViolation) coverageJSON {
+	out := coverageJSON{
+		SchemaVersion:  jsonSchemaVersion,
+		ScheduleID:     scheduleID,
+		Start:          start.Format(time.RFC3339),
+		End:            end.Format(time.RFC3339),
+		Valid:          len(violations) == 0,
+		UncoveredHours: uncoveredHours(violations),
+		Violations:     []coverageViolationJSON{},
+	}
+	for _, violation := range violations {
+		kind := "overlap"
+		if violation.Gap() {
+			kind = "gap"
+		}
+		out.Violations = append(out.Violations, coverageViolationJSON{
+			Kind:   kind,
+			Start:  violation.Start.Format(time.RFC3339),
+			End:    violation.End.Format(time.RFC3339),
+			Hours:  violation.End.Sub(violation.Start).Hours(),
+			People: nonNil(violation.People),
+		})
+	}
+	return out
+}
+
+type verifyJSON struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	ScheduleID    string            `json:"scheduleId"`
+	Start         string            `json:"start"`
+	End           string            `json:"end"`
+	Valid         bool              `json:"valid"`
+	Discrepancies []discrepancyJSON `json:"discrepancies"`
+}
+
+type discrepancyJSON struct {
+	Kind     string   `json:"kind"` // "missing", "unexpected" or "mismatch"
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Hours    float64  `json:"hours"`
+	Expected []string `json:"expected"`
+	Actual   []string `json:"actual"`
+}
+
+func newVerifyJSON(scheduleID string, start, end time.Time, discrepancies []opsgenie.Discrepancy) verifyJSON {
+	out := verifyJSON{
+		SchemaVersion: jsonSchemaVersion,
+		ScheduleID:    scheduleID,
+		Start:         start.Format(time.RFC3339),
+		End:           end.Format(time.RFC3339),
+		Valid:         len(discrepancies) == 0,
+		Discrepancies: []discrepancyJSON{},
+	}
+	for _, discrepancy := range discrepancies {
+		out.Discrepancies = append(out.Discrepancies, discrepancyJSON{
+			Kind:     discrepancy.Kind(),
+			Start:    discrepancy.Start.Format(time.RFC3339),
+			End:      discrepancy.End.Format(time.RFC3339),
+			Hours:    discrepancy.End.Sub(discrepancy.Start).Hours(),
+			Expected: nonNil(discrepancy.Expected),
+			Actual:   nonNil(discrepancy.Actual),
+		})
+	}
+	return out
+}
+
+type schedulesJSON struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	Count         int            `json:"count"`
+	Pages         int            `json:"pages"` // schedule list pages fetched from the API
+	Schedules     []scheduleJSON `json:"schedules"`
+}
+
+type scheduleJSON struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	Timezone string `json:"timezone"`
+}
+
+func newSchedulesJSON(schedules []opsgenie.Schedule, pages int) schedulesJSON {
+	out := schedulesJSON{
+		SchemaVersion: jsonSchemaVersion,
+		Count:         len(schedules),
+		Pages:         pages,
+		Schedules:     []scheduleJSON{},
+	}
+	for _, schedule := range schedules {
+		out.Schedules = append(out.Schedules, scheduleJSON{
+			ID:       schedule.ID,
+			Name:     schedule.Name,
+			Enabled:  schedule.Enabled,
+			Timezone: schedule.Timezone,
+		})
+	}
+	return out
+}
+
+type rosterJSON struct {
+	SchemaVersion int                      `json:"schemaVersion"`
+	At            string                   `json:"at"`
+	People        []rosterEntryJSON        `json:"people"`
+	Contacts      map[string][]contactJSON `json:"contacts,omitempty"` // only with -contacts
+}
+
+type rosterEntryJSON struct {
+	Name      string   `json:"name"`
+	Schedules []string `json:"schedules"`
+}
+
+// reportedInstant returns at, or for zero (now) the instant statuses were queried for, which
+// is the current time when there are no statuses
+func reportedInstant(at time.Time, statuses []*opsgenie.ScheduleStatus) time.Time {
+	switch {
+	case !at.IsZero():
+		return at
+	case len(statuses) > 0:
+		return statuses[0].At
+	default:
+		return time.Now().UTC()
+	}
+}
+
+// newRosterJSON converts a roster built from statuses; at is the queried instant, or zero for now
+func newRosterJSON(roster []opsgenie.RosterEntry, statuses []*opsgenie.ScheduleStatus, at time.Time) rosterJSON {
+	at = reportedInstant(at, statuses)
+	out := rosterJSON{
+		SchemaVersion: jsonSchemaVersion,
+		At:            at.Format(time.RFC3339),
+		People:        []rosterEntryJSON{},
+	}
+	for _, entry := range roster {
+		out.People = append(out.People, rosterEntryJSON{Name: entry.Name, Schedules: nonNil(entry.Schedules)})
+	}
+	return out
+}
+
+type alertsJSON struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	At            string            `json:"at"`
+	AlertsFetched int               `json:"alertsFetched"`
+	People        []alertPersonJSON `json:"people"`
+}
+
+type alertPersonJSON struct {
+	Name       string         `json:"name"`
+	Schedules  []string       `json:"schedules"`
+	OpenAlerts int            `json:"openAlerts"`
+	Priorities map[string]int `json:"priorities"`
+}
+
+func newAlertsJSON(people []onCallAlerts, at time.Time, fetched int) alertsJSON {
+	out := alertsJSON{
+		SchemaVersion: jsonSchemaVersion,
+		At:            at.Format(time.RFC3339),
+		AlertsFetched: fetched,
+		People:        []alertPersonJSON{},
+	}
+	for _, person := range people {
+		out.People = append(out.People, alertPersonJSON{
+			Name:       person.Entry.Name,
+			Schedules:  nonNil(person.Entry.Schedules),
+			OpenAlerts: person.Open,
+			Priorities: person.Priorities,
+		})
+	}
+	return out
+}
+
+// newStatusesJSON converts statuses for output; at is the queried instant, or zero for now
+func newStatusesJSON(statuses []*opsgenie.ScheduleStatus, at time.Time) statusesJSON {
+	at = reportedInstant(at, statuses)
+	out := statusesJSON{
+		SchemaVersion: jsonSchemaVersion,
+		At:            at.Format(time.RFC3339),
+		Schedules:     []statusJSON{},
+	}
+	for _, status := range statuses {
+		out.Schedules = append(out.Schedules, newStatusJSON(status))
+	}
+	return out
+}
+
+func newStatusJSON(status *opsgenie.ScheduleStatus) statusJSON {
+	entry := statusJSON{
+		ScheduleID:    status.ScheduleID,
+		ScheduleName:  status.ScheduleName,
+		Timezone:      status.Timezone,
+		CurrentOnCall: nonNil(status.CurrentOnCall),
+		NextOnCall:    nonNil(status.NextOnCall),
+		ShiftEndsSoon: status.ShiftEndsSoon,
+		CoverageGap:   status.CoverageGap,
+		NoSuccessor:   status.NoSuccessor,
+		Disabled:      status.Disabled,
+	}
+	if !status.ShiftEndsAt.IsZero() {
+		entry.ShiftEndsAt = status.ShiftEndsAt.Format(time.RFC3339)
+	}
+	if !status.NextShiftStartsAt.IsZero() {
+		entry.NextShiftStartsAt = status.NextShiftStartsAt.Format(time.RFC3339)
+	}
+	if status.Err != nil {
+		entry.Error = status.Err.Error()
+	}
+	if status.ShiftErr != nil {
+		entry.ShiftError = status.ShiftErr.Error()
+	}
+	entry.Participants = status.Participants
+	if status.ParticipantsErr != nil {
+		entry.ParticipantsError = status.ParticipantsErr.Error()
+	}
+	return entry
+}
+
+// compactStatusJSON is a -format compact-json line: one schedule's status, stamped for log ingestion
+type compactStatusJSON struct {
+	Timestamp     string `json:"timestamp"`
+	Type          string `json:"type"` // "schedule"
+	SchemaVersion int    `json:"schemaVersion"`
+	At            string `json:"at"`
+	statusJSON
+}
+
+// compactRunJSON is the last -format compact-json line of a run
+type compactRunJSON struct {
+	Timestamp     string `json:"timestamp"`
+	Type          string `json:"type"` // "run"
+	SchemaVersion int    `json:"schemaVersion"`
+	At            string `json:"at"`
+	Schedules     int    `json:"schedules"`
+	OnCall        int    `json:"onCall"` // schedules with someone on call
+	Empty         int    `json:"empty"`  // schedules fetched with no one on call
+	Errors        int    `json:"errors"` // schedules whose on-call lookup failed
+	DurationMs    int64  `json:"durationMs"`
+}
+
+// writeCompactJSON writes a line per status and a run summary line, all with the same
+// timestamp; at is the queried instant, or zero for now, and duration how long the fetch took
+func writeCompactJSON(w io.Writer, statuses []*opsgenie.ScheduleStatus, at time.Time, duration time.Duration) error {
+	at = reportedInstant(at, statuses)
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+	run := compactRunJSON{
+		Timestamp:     timestamp,
+		Type:          "run",
+		SchemaVersion: jsonSchemaVersion,
+		At:            at.Format(time.RFC3339),
+		Schedules:     len(statuses),
+		DurationMs:    duration.Milliseconds(),
+	}
+	for _, status := range statuses {
+		switch {
+		case status.Err != nil:
+			run.Errors++
+		case len(status.CurrentOnCall) == 0:
+			run.Empty++
+		default:
+			run.OnCall++
+		}
+		line := compactStatusJSON{
+			Timestamp:     timestamp,
+			Type:          "schedule",
+			SchemaVersion: jsonSchemaVersion,
+			At:            run.At,
+			statusJSON:    newStatusJSON(status),
+		}
+		if err := writeJSON(w, line, false); err != nil {
+			return err
+		}
+	}
+	return writeJSON(w, run, false)
+}
+
+// nonNil makes empty lists encode as [] rather than null
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func writeJSON(w io.Writer, v any, indent bool) error {
+	encoder := json.NewEncoder(w)
+	if indent {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder.Encode(v)
+}
+
+// writeJSONFile writes v as indented JSON to path atomically, for -summary-json
+func writeJSONFile(path string, v any) error {
+	var writeErr error
+	err := writeFileAtomically(path, func(w io.Writer) {
+		writeErr = writeJSON(w, v, true)
+	})
+	if err == nil {
+		err = writeErr
+	}
+	return err
+}
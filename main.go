@@ -1,161 +1,19 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
-	"sort"
+	"os/signal"
 	"strings"
-	"sync"
 	"time"
 
-	"golang.org/x/exp/rand"
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
 )
 
-// Structs to parse OpsGenie Who is on Call API responses
-type OnCallResponse struct {
-	Data      OnCallData `json:"data"`
-	Took      float64    `json:"took"`
-	RequestID string     `json:"requestId"`
-}
-
-type OnCallData struct {
-	Parent           Parent   `json:"_parent"`
-	OnCallRecipients []string `json:"onCallRecipients"`
-}
-
-type Parent struct {
-	ID      string `json:"id"`
-	Name    string `json:"name"`
-	Enabled bool   `json:"enabled"`
-}
-
-// Struct to hold aggregated data per person
-type PersonData struct {
-	Name       string
-	TotalHours float64
-}
-
-// Structs for whoisoncall command
-
-// List schedules API
-type SchedulesResponse struct {
-	Data      []Schedule `json:"data"`
-	Took      float64    `json:"took"`
-	RequestID string     `json:"requestId"`
-}
-
-type Schedule struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Enabled  bool   `json:"enabled"`
-	Timezone string `json:"timezone"`
-}
-
-// Next on-call API
-type NextOnCallResponse struct {
-	Data      NextOnCallData `json:"data"`
-	Took      float64        `json:"took"`
-	RequestID string         `json:"requestId"`
-}
-
-type NextOnCallData struct {
-	Parent           Parent   `json:"_parent"`
-	OnCallRecipients []string `json:"onCallRecipients"`
-}
-
-// Timeline API (for shift end detection)
-type TimelineResponse struct {
-	Data      TimelineData `json:"data"`
-	Took      float64      `json:"took"`
-	RequestID string       `json:"requestId"`
-}
-
-type TimelineData struct {
-	FinalTimeline Timeline `json:"finalTimeline"`
-}
-
-type Timeline struct {
-	Rotations []TimelineRotation `json:"rotations"`
-}
-
-type TimelineRotation struct {
-	Periods []RotationPeriod `json:"periods"`
-}
-
-type RotationPeriod struct {
-	StartDate string `json:"startDate"`
-	EndDate   string `json:"endDate"`
-}
-
-// Display struct
-type ScheduleStatus struct {
-	ScheduleID    string
-	ScheduleName  string
-	CurrentOnCall []string
-	NextOnCall    []string
-	ShiftEndsAt   time.Time
-	ShiftEndsSoon bool // true if ends within 1 hour
-}
-
-// Helper functions
-
-func createHTTPClient() *http.Client {
-	return &http.Client{
-		Timeout: time.Second * 30,
-	}
-}
-
-func makeAPIRequestWithRetry(client *http.Client, url, apiKey string) ([]byte, error) {
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "GenieKey "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	maxRetries := 5
-	retries := 0
-	backoff := time.Second * 2
-
-	for {
-		resp, err := client.Do(req)
-		if err != nil {
-			return nil, fmt.Errorf("request failed: %w", err)
-		}
-
-		body, err := io.ReadAll(resp.Body)
-		resp.Body.Close()
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response: %w", err)
-		}
-
-		// Handle rate limiting
-		if resp.StatusCode == http.StatusTooManyRequests {
-			if retries >= maxRetries {
-				return nil, fmt.Errorf("exceeded maximum retries due to rate limiting")
-			}
-			log.Printf("Rate limited. Retrying in %v...", backoff)
-			retries++
-			time.Sleep(backoff)
-			backoff *= 2
-			continue
-		}
-
-		// Check for non-200 status codes
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("API response status: %s, body: %s", resp.Status, string(body))
-		}
-
-		return body, nil
-	}
-}
-
 func printUsage() {
 	fmt.Println("OpsGenie On-Call Tool")
 	fmt.Println("\nUsage:")
@@ -163,441 +21,441 @@ func printUsage() {
 	fmt.Println("\nCommands:")
 	fmt.Println("  oncall        Generate on-call report for a schedule over a date range")
 	fmt.Println("  whoisoncall   Show current on-call person for schedules (uses default filter)")
+	fmt.Println("  whoson        Show who will be on call at a given -date (takes the whoisoncall flags)")
+	fmt.Println("  who           Print only the people on call for one schedule at one instant, for scripts")
+	fmt.Println("  schedules     List every schedule visible to the API key")
+	fmt.Println("  handoffs      List every change of who is on call for a schedule over a date range")
+	fmt.Println("  validate-coverage  Check that exactly one person is on call at every moment of a date range")
+	fmt.Println("  verify        Compare a schedule with an expected rotation from a CSV file and list the differences")
+	fmt.Println("  ics           Export a schedule's on-call shifts over a date range as an iCalendar file")
+	fmt.Println("  alerts        Count open alerts owned by each person currently on call")
+	fmt.Println("  doctor        Check the API key, region, schedule access and rate limit in one go")
+	fmt.Println("  json-schema   Print the JSON Schema of a command's -format json output")
 	fmt.Println("\noncall flags:")
-	fmt.Println("  -start      Start date (YYYY-MM-DD)")
-	fmt.Println("  -end        End date (YYYY-MM-DD)")
-	fmt.Println("  -schedule   OpsGenie Schedule ID (UUID)")
+	fmt.Println("  -start      Start date (YYYY-MM-DD) or time (YYYY-MM-DD HH:MM, RFC3339)")
+	fmt.Println("  -end        End date, inclusive (YYYY-MM-DD) or exclusive end time (YYYY-MM-DD HH:MM, RFC3339)")
+	fmt.Println("  -ranges     Comma-separated START:END ranges (START/END for times) summed into one report, instead of -start/-end")
+	fmt.Println("  -schedule   OpsGenie schedule ID (UUID) or name, or comma-separated IDs/names to combine")
+	fmt.Println("  -by-schedule With several schedules, print a section per schedule plus the combined total")
+	fmt.Println("  -sort       Row order: name, hours (most first), hours-asc (fewest first) (default: name)")
+	fmt.Println("  -precision  Decimal places in numeric output (default: 2)")
+	fmt.Println("  -round      Round each person's total before summing: none, hour, half-hour (default: none)")
+	fmt.Println("  -exact      Use timeline period durations (fractional hours) instead of hourly sampling")
+	fmt.Println("  -clip-to-range  With -exact, count only the part of shifts inside the range (default: true)")
+	fmt.Println("  -rotation       With -exact, only count one rotation (ID, name or 1-based position)")
+	fmt.Println("  -expand-teams   Credit team recipients' hours to each team member (not with -exact)")
+	fmt.Println("  -format     Output format: auto, table, json, template, openmetrics (default: auto = table on a terminal, json when piped)")
+	fmt.Println("  -template   Go text/template or @file, executed against the report (implies -format template)")
+	fmt.Println("  -request-interval  Pause between hourly requests, 0 disables (default: 750ms)")
+	fmt.Println("  -hourly-rate    Hourly on-call rate; adds business/off-hours and estimated cost columns")
+	fmt.Println("  -off-hours-multiplier  Rate multiplier for off-hours (default: 1)")
+	fmt.Println("  -business-hours Weekday business hours as START-END (default: 9-17)")
+	fmt.Println("  -tz         Time zone for business hours and heatmap days (default: UTC)")
+	fmt.Println("  -max-concurrent People expected on call at once; more is warned about as an overlap (default: 1)")
+	fmt.Println("  -verbose        List each overlap of concurrent on-call recipients and log API rate-limit headers")
+	fmt.Println("  -weekdays-only  Leave Saturdays and Sundays (in -tz) out of the hours and coverage")
+	fmt.Println("  -no-progress-newline  Print progress as newline-delimited lines instead of a \\r spinner")
+	fmt.Println("  -date-format Go layout for dates in the report header, e.g. 02/01/2006 (default: 2006-01-02)")
+	fmt.Println("  -heatmap    Also print an ASCII heatmap of hours per person (rows) and day (columns)")
+	fmt.Println("  -by-team        Also print hours per team (team members from -team-map or the teams API)")
+	fmt.Println("  -team-map       CSV of person,team rows for -by-team instead of the teams API")
+	fmt.Println("  -normalize-names Show people as title-cased display names in the table (JSON stays raw)")
+	fmt.Println("  -anonymize      Replace names with pseudonyms (Person A, B, ... by hours) in all output")
+	fmt.Println("  -anonymize-map  With -anonymize, write the pseudonym,name mapping to this CSV file")
+	fmt.Println("  -load           Add each person's FTE share of the range and weeks of 24/7 coverage")
+	fmt.Println("  -summary-only   Print only the totals, without the per-person rows (not with -heatmap or -template)")
+	fmt.Println("  -identity-map   CSV of alias,canonical rows to merge one person's names")
+	fmt.Println("  -exclude-person Comma-separated patterns (substring or regex) of recipients to leave out, e.g. bots")
+	fmt.Println("  -concurrency    Number of -schedule IDs to report on at the same time, or auto (default: 1)")
+	fmt.Println("  -checkpoint     Save progress to this file periodically (removed when the report completes)")
+	fmt.Println("  -resume         Continue an interrupted report from its -checkpoint file")
+	fmt.Println("  -from-file      Replay responses saved with -dump-dir (a file or the directory) instead of querying the API")
+	fmt.Println("  -summary-json   Also write the -format json report to this file while printing the table")
 	fmt.Println("\nwhoisoncall flags:")
 	fmt.Println("  -filter    Comma-separated list of schedule names/IDs (default: key schedules)")
 	fmt.Println("             Use -filter \"\" to show all schedules")
+	fmt.Println("  -filter-file File of schedule names/IDs, one per line (# comments); combined with -filter")
+	fmt.Println("  -enabled-only Skip disabled schedules without querying them (default: true)")
+	fmt.Println("  -client-side-filter Always list every schedule and filter locally instead of querying the API by name")
+	fmt.Println("  -names-only Print only the deduplicated, sorted names of people on call")
+	fmt.Println("  -oneline   Print one line like \"Production: alice (handoff in 45m)\" for status bars")
+	fmt.Println("  -all-recipients Print one deduplicated roster of everyone on call and the schedules they cover")
+	fmt.Println("             (all schedules unless -filter is given)")
+	fmt.Println("  -format    Output format: auto, table, json, compact-json, prometheus-textfile, template, grafana (default: auto)")
+	fmt.Println("  -template  Go text/template or @file, executed against the schedule statuses (implies -format template)")
+	fmt.Println("  -output    Output file, written atomically (required for prometheus-textfile)")
+	fmt.Println("  -listen    Address to serve the Grafana Simple JSON datasource on (required for grafana), e.g. :8080")
+	fmt.Println("  -sort      Sort order: name, shift-end, status (default: name)")
+	fmt.Println("  -watch     Refresh at this interval until interrupted (e.g. 1m)")
+	fmt.Println("  -on-change With -watch, only print timestamped changes after the first poll")
+	fmt.Println("  -webhook-url With -watch, POST a JSON reminder once per handoff when a shift ends within the hour")
+	fmt.Println("  -at        Show who was (or will be) on call at an RFC3339 instant instead of now")
+	fmt.Println("  -expand-teams Replace team recipients with their member users")
+	fmt.Println("  -fail-if-soon Exit with code 5 if any matched schedule's shift ends within the hour")
+	fmt.Println("  -date-format Go layout for the \"On call at\" header, e.g. 02/01/2006")
+	fmt.Println("  -show-tz   Add a column with each schedule's time zone and local time")
+	fmt.Println("  -normalize-names Show people as title-cased display names in tables (JSON stays raw)")
+	fmt.Println("  -color     Colorize the table: auto, always, never (default: auto, off when piped or NO_COLOR is set)")
+	fmt.Println("  -columns   Table columns in order, from name, current, next, tz, shift_end, participants")
+	fmt.Println("  -max-width Width of the people columns; people who do not fit show as \"+N more\" (default: 50, 60 for participants)")
+	fmt.Println("  -absolute-times Show shift ends and starts as clock times in each schedule's time zone, not \"in 45m\"")
+	fmt.Println("  -show-participants Also list everyone in each schedule's rotations")
+	fmt.Println("  -recipient-type Only show participants of one type: user, team, escalation")
+	fmt.Println("  -rotation  Only show one rotation of each schedule (ID, name or 1-based position)")
+	fmt.Println("  -contacts  Also list the contact methods of everyone on call (needs configuration access)")
+	fmt.Println("  -since-last-run <path> Only print on-call changes since the previous run, keeping state in <path>")
+	fmt.Println("  -retry-on-empty Query an empty schedule once more after 2s (transient empty results at handoffs)")
+	fmt.Println("  -compact-empty Collapse schedules with no one on call into a footer line")
+	fmt.Println("  -from-file Replay responses saved with -dump-dir (a file or the directory) instead of querying the API")
+	fmt.Println("  -summary-json Also write the -format json document to this file while printing the table")
+	fmt.Println("\nwhoson flags (plus the whoisoncall flags except -at and -watch):")
+	fmt.Println("  -date      Date (YYYY-MM-DD, midnight UTC) or time (YYYY-MM-DD HH:MM, RFC3339) to look up")
+	fmt.Println("\nwho flags:")
+	fmt.Println("  -schedule  OpsGenie schedule ID (UUID) or name")
+	fmt.Println("  -at        RFC3339 instant to look up (default: now)")
+	fmt.Println("  -expand-teams Replace team recipients with their member users")
+	fmt.Println("\nschedules flags:")
+	fmt.Println("  -format    Output format: auto, table, json (default: auto)")
+	fmt.Println("\nhandoffs flags:")
+	fmt.Println("  -start, -end, -schedule  As for oncall (one schedule)")
+	fmt.Println("  -rotation  Only follow one rotation (ID, name or 1-based position)")
+	fmt.Println("  -format    Output format: auto, table, json (default: auto)")
+	fmt.Println("  -date-format Go layout for the handoff times, e.g. 02/01/2006")
+	fmt.Println("\nvalidate-coverage flags:")
+	fmt.Println("  -start, -end, -schedule, -rotation, -format, -date-format  As for handoffs")
+	fmt.Println("  -only-gaps Only list gaps and the total uncovered hours; overlaps are ignored")
+	fmt.Println("\nverify flags:")
+	fmt.Println("  -expected  CSV of start,end,person rows (dates or times as for -start/-end); sets the range")
+	fmt.Println("  -schedule, -rotation, -format, -date-format  As for handoffs")
+	fmt.Println("\nics flags:")
+	fmt.Println("  -start, -end, -schedule, -rotation  As for handoffs")
+	fmt.Println("  -person    Only export this person's shifts (username or email)")
+	fmt.Println("  -output    Write the calendar to this file instead of stdout")
+	fmt.Println("\nalerts flags:")
+	fmt.Println("  -filter    Comma-separated list of schedule names/IDs (default: key schedules)")
+	fmt.Println("  -enabled-only Skip disabled schedules (default: true)")
+	fmt.Println("  -client-side-filter As for whoisoncall")
+	fmt.Println("  -limit     Maximum number of open alerts to fetch (default: 500)")
+	fmt.Println("  -format    Output format: auto, table, json (default: auto)")
+	fmt.Println("\nCommon flags (all commands):")
+	fmt.Println("  -api-key    OpsGenie API key (visible in process lists; prefer -api-key-file or OPSGENIE_API_KEY)")
+	fmt.Println("  -api-key-file  File containing the OpsGenie API key (the OS keyring is not read; export the key from it instead)")
+	fmt.Println("  -retry-log  Append timestamp, URL, attempts and final status of every retried request to a file")
+	fmt.Println("  -http-timeout  Timeout for each individual HTTP request (default: 30s)")
+	fmt.Println("  -timeout    Deadline for all API requests of the command together, e.g. 20s (default: none)")
+	fmt.Println("  -dump-dir   Save every API response to this directory (replay with whoisoncall/oncall -from-file)")
+	fmt.Println("\nJSON flags (commands with -format json):")
+	fmt.Println("  -json-indent  Indent JSON output (default: true on a terminal, false when piped)")
 	fmt.Println("\nExamples:")
 	fmt.Println("  opsgenie-on-call oncall -start 2024-12-01 -end 2024-12-31 -schedule abc-123")
+	fmt.Println("  opsgenie-on-call oncall -start \"2024-12-01 08:00\" -end \"2024-12-02 08:00\" -schedule abc-123")
+	fmt.Println("  opsgenie-on-call oncall -ranges \"2025-01-01:2025-01-31,2025-03-01:2025-03-31\" -schedule abc-123")
 	fmt.Println("  opsgenie-on-call whoisoncall")
 	fmt.Println("  opsgenie-on-call whoisoncall -filter \"\"")
 	fmt.Println("  opsgenie-on-call whoisoncall -filter \"Production,Database\"")
+	fmt.Println("  opsgenie-on-call whoisoncall -names-only")
+	fmt.Println("  opsgenie-on-call whoisoncall -format json")
+	fmt.Println("  opsgenie-on-call whoisoncall -all-recipients")
+	fmt.Println("  opsgenie-on-call whoson -date 2025-01-01")
+	fmt.Println("  opsgenie-on-call who -schedule abc-123 -at 2025-01-01T03:00:00Z")
+	fmt.Println("  opsgenie-on-call handoffs -start 2024-12-01 -end 2024-12-07 -schedule abc-123")
+	fmt.Println("  opsgenie-on-call validate-coverage -start 2025-01-01 -end 2025-03-31 -schedule abc-123")
+	fmt.Println("  opsgenie-on-call verify -expected q1-rotation.csv -schedule abc-123")
+	fmt.Println("  opsgenie-on-call ics -start 2025-01-01 -end 2025-03-31 -schedule abc-123 -person alice -output oncall.ics")
+	fmt.Println("  opsgenie-on-call alerts -limit 1000")
+	fmt.Println("  opsgenie-on-call json-schema whoisoncall")
+	fmt.Println("  opsgenie-on-call doctor")
+	fmt.Println("  opsgenie-on-call whoisoncall -watch 1m -on-change")
+	fmt.Println("  opsgenie-on-call whoisoncall -filter \"Production\" -at 2024-12-01T03:00:00Z")
+	fmt.Println("  opsgenie-on-call whoisoncall -format prometheus-textfile -output /var/lib/node_exporter/opsgenie.prom")
+	fmt.Println("\nExit codes:")
+	fmt.Println("  0 success, 1 error, 2 invalid usage, 3 authentication error,")
+	fmt.Println("  4 partial failure (some schedules failed), 5 handoff soon (-fail-if-soon),")
+	fmt.Println("  6 coverage violations (validate-coverage) or rotation drift (verify), 130 interrupted")
 	fmt.Println("\nEnvironment Variables:")
-	fmt.Println("  OPSGENIE_API_KEY    OpsGenie API key (required)")
+	fmt.Println("  OPSGENIE_API_KEY    OpsGenie API key (required unless -api-key or -api-key-file is given)")
+	fmt.Println("  NO_COLOR            Disable colored output when set (unless -color always)")
 }
 
-func runOnCallCommand(args []string) {
-	// Create flag set for oncall subcommand
-	oncallFlags := flag.NewFlagSet("oncall", flag.ExitOnError)
-	startDateStr := oncallFlags.String("start", "", "Start date (YYYY-MM-DD)")
-	endDateStr := oncallFlags.String("end", "", "End date (YYYY-MM-DD)")
-	scheduleID := oncallFlags.String("schedule", "", "OpsGenie Schedule ID (UUID)")
-
-	oncallFlags.Parse(args)
-
-	// Validate required arguments
-	if *startDateStr == "" || *endDateStr == "" || *scheduleID == "" {
-		log.Fatal("Start date, End date, and Schedule ID must be provided.")
-	}
-
-	// Parse start and end dates in UTC
-	startDate, err := time.Parse("2006-01-02", *startDateStr)
-	if err != nil {
-		log.Fatalf("Invalid start date format: %v", err)
-	}
-	startDate = startDate.UTC()
-	endDate, err := time.Parse("2006-01-02", *endDateStr)
-	if err != nil {
-		log.Fatalf("Invalid end date format: %v", err)
-	}
-	endDate = endDate.UTC().AddDate(0, 0, 1).Add(-time.Second) // End of the end date
-
-	// Get API key from environment variable
-	apiKey := os.Getenv("OPSGENIE_API_KEY")
-	if apiKey == "" {
-		log.Fatal("OPSGENIE_API_KEY environment variable not set.")
-	}
-
-	// Initialize HTTP client
-	client := createHTTPClient()
+// Process exit codes
+const (
+	exitOK          = 0
+	exitError       = 1
+	exitUsage       = 2 // invalid flags or arguments
+	exitAuth        = 3
+	exitPartial     = 4 // some schedules could not be fetched
+	exitHandoffSoon = 5 // -fail-if-soon matched a shift ending within the hour
+	exitCoverage    = 6 // validate-coverage found gaps or overlaps, or verify found drift
+	exitInterrupted = 130
+)
 
-	// Initialize map to hold person data
-	personMap := make(map[string]*PersonData)
+// errPartialFailure marks a command that produced output but failed for some schedules
+var errPartialFailure = errors.New("some schedules could not be fetched")
 
-	// Iterate over each hour in the date range
-	for current := startDate; !current.After(endDate); current = current.Add(time.Hour) {
-		// Format date to RFC3339
-		formattedDate := current.Format(time.RFC3339)
+// errHandoffSoon is returned by whoisoncall -fail-if-soon when a shift ends within the hour
+var errHandoffSoon = errors.New("on-call handoff in progress")
 
-		// Build API request URL with flat=true
-		url := fmt.Sprintf("https://api.opsgenie.com/v2/schedules/%s/on-calls?date=%s&flat=true",
-			*scheduleID, formattedDate)
+// errCoverageViolations is returned by validate-coverage when someone other than exactly one
+// person is on call at some point of the range
+var errCoverageViolations = errors.New("coverage violations found")
 
-		body, err := makeAPIRequestWithRetry(client, url, apiKey)
-		if err != nil {
-			log.Fatalf("API request failed: %v", err)
-		}
+// errRotationDrift is returned by verify when the schedule differs from the expected rotation
+var errRotationDrift = errors.New("schedule differs from the expected rotation")
 
-		// Parse JSON response
-		var onCallResp OnCallResponse
-		err = json.Unmarshal(body, &onCallResp)
-		if err != nil {
-			log.Fatalf("Failed to parse JSON: %v", err)
-		}
-
-		// Process each on-call recipient
-		for _, recipient := range onCallResp.Data.OnCallRecipients {
-			userName := recipient
-			if userName == "" {
-				continue
-			}
-			if _, exists := personMap[userName]; !exists {
-				personMap[userName] = &PersonData{Name: userName, TotalHours: 0}
-			}
-			personMap[userName].TotalHours += 1.0
-		}
-
-		delay := time.Duration(rand.Intn(500)+500) * time.Millisecond
-		time.Sleep(delay)
-		fmt.Printf("\rProcessed date: %s", formattedDate)
+// exitCode maps a command error to the process exit code
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
 	}
-
-	// Initialize totals
-	var totalHours float64
-	for _, pdata := range personMap {
-		totalHours += pdata.TotalHours
+	if errors.Is(err, errPartialFailure) {
+		return exitPartial
 	}
-
-	totalDays := totalHours / 24
-	totalWeeks := totalDays / 7
-
-	// Print report
-	fmt.Println("\n\nOn-Call Report")
-	fmt.Println("==============")
-	fmt.Printf("Period: %s to %s\n\n", startDate.Format("2006-01-02"), endDate.Format("2006-01-02"))
-	fmt.Printf("%-40s %-15s\n", "Name", "Total Hours")
-	fmt.Println("-------------------------------------------------------------")
-	for _, pdata := range personMap {
-		fmt.Printf("%-40s %-15.2f\n", pdata.Name, pdata.TotalHours)
+	if errors.Is(err, errHandoffSoon) {
+		return exitHandoffSoon
 	}
-	fmt.Println("\n-------------------------------------------------------------")
-	fmt.Printf("Total Hours: %.2f\n", totalHours)
-	fmt.Printf("Total Days: %.2f\n", totalDays)
-	fmt.Printf("Total 7-Day Weeks: %.2f\n", totalWeeks)
-}
-
-// Functions for whoisoncall command
-
-func fetchAllSchedules(client *http.Client, apiKey string) ([]Schedule, error) {
-	url := "https://api.opsgenie.com/v2/schedules"
-	body, err := makeAPIRequestWithRetry(client, url, apiKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch schedules: %w", err)
+	if errors.Is(err, errCoverageViolations) || errors.Is(err, errRotationDrift) {
+		return exitCoverage
 	}
-
-	var schedulesResp SchedulesResponse
-	err = json.Unmarshal(body, &schedulesResp)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse schedules response: %w", err)
+	switch opsgenie.KindOf(err) {
+	case opsgenie.KindValidation:
+		return exitUsage
+	case opsgenie.KindAuth:
+		return exitAuth
+	default:
+		return exitError
 	}
-
-	return schedulesResp.Data, nil
 }
 
-func matchesFilter(schedule Schedule, filters []string) bool {
-	if len(filters) == 0 {
-		return true
-	}
-
-	scheduleName := strings.ToLower(schedule.Name)
-	scheduleID := strings.ToLower(schedule.ID)
+// defaultDateLayout is the date layout of human-readable output unless -date-format is given
+const defaultDateLayout = "2006-01-02"
 
-	for _, filter := range filters {
-		filterLower := strings.ToLower(strings.TrimSpace(filter))
-		// Exact match for schedule name or substring match for ID
-		if scheduleName == filterLower || strings.Contains(scheduleID, filterLower) {
-			return true
-		}
-	}
-	return false
+// humanDates formats dates and times in human-readable output; machine formats (JSON,
+// metrics, progress lines) always use RFC3339
+type humanDates struct {
+	layout string
 }
 
-func checkShiftEndsSoon(client *http.Client, apiKey, scheduleID string, now time.Time) (time.Time, bool) {
-	// Request timeline from now to +2 hours
-	url := fmt.Sprintf(
-		"https://api.opsgenie.com/v2/schedules/%s/timeline?date=%s&interval=2&intervalUnit=hours",
-		scheduleID,
-		now.Format(time.RFC3339),
-	)
-
-	body, err := makeAPIRequestWithRetry(client, url, apiKey)
-	if err != nil {
-		return time.Time{}, false
-	}
-
-	var timeline TimelineResponse
-	err = json.Unmarshal(body, &timeline)
-	if err != nil {
-		return time.Time{}, false
-	}
-
-	// Check periods in finalTimeline
-	for _, rotation := range timeline.Data.FinalTimeline.Rotations {
-		for _, period := range rotation.Periods {
-			periodStart, err1 := time.Parse(time.RFC3339, period.StartDate)
-			periodEnd, err2 := time.Parse(time.RFC3339, period.EndDate)
-
-			if err1 != nil || err2 != nil {
-				continue
-			}
-
-			// Check if this is the current period
-			if (periodStart.Before(now) || periodStart.Equal(now)) && periodEnd.After(now) {
-				duration := periodEnd.Sub(now)
-				if duration <= time.Hour {
-					return periodEnd, true
-				}
-				return periodEnd, false
-			}
-		}
-	}
-
-	return time.Time{}, false
+// addJSONIndentFlag registers -json-indent: indented JSON on a terminal, and compact JSON,
+// one document per line, when piped
+func addJSONIndentFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("json-indent", stdoutIsTerminal(), "Indent JSON output; the default is true on a terminal and false when piped, for NDJSON pipelines")
 }
 
-func fetchScheduleStatus(client *http.Client, apiKey string, schedule Schedule) *ScheduleStatus {
-	status := &ScheduleStatus{
-		ScheduleID:   schedule.ID,
-		ScheduleName: schedule.Name,
-	}
+func addDateFormatFlag(fs *flag.FlagSet) *string {
+	return fs.String("date-format", defaultDateLayout, "Go time layout for dates in human-readable output, e.g. 02/01/2006 for DD/MM/YYYY")
+}
 
-	now := time.Now().UTC()
+func addEnabledOnlyFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("enabled-only", true, "Skip disabled schedules, which are not queried at all; -enabled-only=false includes them")
+}
 
-	// Fetch current on-call
-	currentURL := fmt.Sprintf("https://api.opsgenie.com/v2/schedules/%s/on-calls?flat=true&date=%s",
-		schedule.ID, now.Format(time.RFC3339))
+func addClientSideFilterFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool("client-side-filter", false, "Always list every schedule and filter locally, instead of asking the API for the -filter names first")
+}
 
-	body, err := makeAPIRequestWithRetry(client, currentURL, apiKey)
-	if err != nil {
-		log.Printf("Warning: Failed to fetch on-call for schedule %s: %v", schedule.Name, err)
-		status.CurrentOnCall = []string{"(error fetching)"}
-		return status
-	}
+func (d humanDates) date(t time.Time) string {
+	return t.Format(d.layout)
+}
 
-	var onCallResp OnCallResponse
-	err = json.Unmarshal(body, &onCallResp)
-	if err != nil {
-		log.Printf("Warning: Failed to parse on-call response for schedule %s: %v", schedule.Name, err)
-		status.CurrentOnCall = []string{"(parse error)"}
-		return status
+// time formats an instant: RFC3339 by default, otherwise the date layout with hours and minutes
+func (d humanDates) time(t time.Time) string {
+	if d.layout == defaultDateLayout {
+		return t.Format(time.RFC3339)
 	}
+	return t.Format(d.layout + " 15:04 MST")
+}
 
-	if len(onCallResp.Data.OnCallRecipients) == 0 {
-		status.CurrentOnCall = []string{"No one on call"}
-	} else {
-		status.CurrentOnCall = onCallResp.Data.OnCallRecipients
+// resolveFormat turns -format auto into table when stdout is a terminal (or tableOnly is
+// set because another flag only renders as text) and json when it is piped or redirected
+func resolveFormat(format string, tableOnly bool) string {
+	if format != "auto" {
+		return format
 	}
-
-	// Check shift timing
-	shiftEnd, endsSoon := checkShiftEndsSoon(client, apiKey, schedule.ID, now)
-	status.ShiftEndsAt = shiftEnd
-	status.ShiftEndsSoon = endsSoon
-
-	// Fetch next on-call if shift ends soon
-	if endsSoon {
-		nextURL := fmt.Sprintf("https://api.opsgenie.com/v2/schedules/%s/next-on-calls?flat=true",
-			schedule.ID)
-		nextBody, err := makeAPIRequestWithRetry(client, nextURL, apiKey)
-		if err != nil {
-			log.Printf("Warning: Failed to fetch next on-call for schedule %s: %v", schedule.Name, err)
-		} else {
-			var nextResp NextOnCallResponse
-			err = json.Unmarshal(nextBody, &nextResp)
-			if err != nil {
-				log.Printf("Warning: Failed to parse next on-call response for schedule %s: %v", schedule.Name, err)
-			} else {
-				status.NextOnCall = nextResp.Data.OnCallRecipients
-			}
-		}
+	if tableOnly || stdoutIsTerminal() {
+		return "table"
 	}
-
-	return status
+	return "json"
 }
 
-func fetchAllScheduleStatuses(client *http.Client, apiKey string, schedules []Schedule) []*ScheduleStatus {
-	// Limit concurrent requests to avoid rate limiting
-	semaphore := make(chan struct{}, 3)
-	results := make(chan *ScheduleStatus, len(schedules))
-	var wg sync.WaitGroup
-
-	for _, schedule := range schedules {
-		wg.Add(1)
-		go func(sched Schedule) {
-			defer wg.Done()
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
-
-			status := fetchScheduleStatus(client, apiKey, sched)
-			results <- status
-
-			// Small delay to avoid rate limiting
-			time.Sleep(time.Millisecond * 100)
-		}(schedule)
-	}
-
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-
-	var statuses []*ScheduleStatus
-	for status := range results {
-		statuses = append(statuses, status)
-	}
+func stdoutIsTerminal() bool {
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
 
-	return statuses
+func validationError(format string, args ...any) error {
+	return &opsgenie.Error{Kind: opsgenie.KindValidation, Err: fmt.Errorf(format, args...)}
 }
 
-func truncate(s string, maxLen int) string {
-	if len(s) <= maxLen {
-		return s
-	}
-	return s[:maxLen-3] + "..."
+// clientFlags are the API client options shared by every subcommand
+type clientFlags struct {
+	apiKey      *string
+	apiKeyFile  *string
+	retryLog    *string
+	httpTimeout *time.Duration
+	timeout     *time.Duration
+	dumpDir     *string
+	fromFile    *string // only set by commands that call addFromFileFlag
 }
 
-func formatRecipients(recipients []string) string {
-	if len(recipients) == 0 {
-		return ""
+func addClientFlags(fs *flag.FlagSet) *clientFlags {
+	return &clientFlags{
+		apiKey:      fs.String("api-key", "", "OpsGenie API key, overriding -api-key-file and OPSGENIE_API_KEY (visible in process lists)"),
+		apiKeyFile:  fs.String("api-key-file", "", "File containing the OpsGenie API key, overriding OPSGENIE_API_KEY"),
+		retryLog:    fs.String("retry-log", "", "Append a line per retried request (timestamp, URL, attempts, final status) to this file"),
+		httpTimeout: fs.Duration("http-timeout", 30*time.Second, "Timeout for each individual HTTP request"),
+		timeout:     fs.Duration("timeout", 0, "Deadline for all of the command's API requests together (e.g. 20s); 0 means none"),
+		dumpDir:     fs.String("dump-dir", "", "Save every API response to this directory, for replaying with -from-file"),
 	}
-	// Strip @behavox.com from emails to save space
-	var cleanedRecipients []string
-	for _, recipient := range recipients {
-		cleaned := strings.TrimSuffix(recipient, "@behavox.com")
-		cleanedRecipients = append(cleanedRecipients, cleaned)
-	}
-	return strings.Join(cleanedRecipients, ", ")
 }
 
-func cleanScheduleName(name string) string {
-	// Remove common suffixes to make names cleaner
-	name = strings.TrimSuffix(name, " Schedule")
-	name = strings.TrimSuffix(name, " schedule")
-	name = strings.TrimSuffix(name, "_schedule")
-	return name
+// addFromFileFlag adds -from-file, which makes newClient answer requests from responses
+// saved with -dump-dir instead of the API
+func (cf *clientFlags) addFromFileFlag(fs *flag.FlagSet) {
+	cf.fromFile = fs.String("from-file", "", "Replay API responses saved with -dump-dir (one response file or the whole directory) instead of querying the API")
 }
 
-func printScheduleStatusTable(statuses []*ScheduleStatus) {
-	// Sort by schedule name
-	sort.Slice(statuses, func(i, j int) bool {
-		return statuses[i].ScheduleName < statuses[j].ScheduleName
-	})
-
-	// Print header
-	fmt.Printf("%-40s %-50s %-50s\n", "Team Name", "Current On-Call", "Next On-Call")
-	fmt.Println(strings.Repeat("=", 140))
-
-	for _, status := range statuses {
-		cleanName := cleanScheduleName(status.ScheduleName)
-		scheduleName := truncate(cleanName, 38)
-		currentOnCall := formatRecipients(status.CurrentOnCall)
-
-		nextOnCall := ""
-		if status.ShiftEndsSoon && len(status.NextOnCall) > 0 {
-			timeRemaining := time.Until(status.ShiftEndsAt)
-			minutes := int(timeRemaining.Minutes())
-			nextRecipients := formatRecipients(status.NextOnCall)
-			nextOnCall = fmt.Sprintf("%s (in %dm)", nextRecipients, minutes)
+// resolveAPIKey returns the OpsGenie API key and a description of where it came from. The
+// -api-key flag wins over -api-key-file, which wins over the OPSGENIE_API_KEY variable.
+func (cf *clientFlags) resolveAPIKey() (string, string, error) {
+	if key := strings.TrimSpace(*cf.apiKey); key != "" {
+		return key, "-api-key flag, visible in process lists", nil
+	}
+	if *cf.apiKeyFile != "" {
+		data, err := os.ReadFile(*cf.apiKeyFile)
+		if err != nil {
+			return "", "", &opsgenie.Error{Kind: opsgenie.KindAuth, Err: fmt.Errorf("cannot read -api-key-file: %w", err)}
 		}
-
-		fmt.Printf("%-40s %-50s %-50s\n", scheduleName, currentOnCall, nextOnCall)
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return "", "", &opsgenie.Error{Kind: opsgenie.KindAuth, Err: fmt.Errorf("-api-key-file %s is empty", *cf.apiKeyFile)}
+		}
+		return key, "file " + *cf.apiKeyFile, nil
 	}
+	key := os.Getenv("OPSGENIE_API_KEY")
+	if key == "" {
+		return "", "", &opsgenie.Error{Kind: opsgenie.KindAuth, Err: errors.New("no API key: set OPSGENIE_API_KEY, -api-key-file or -api-key")}
+	}
+	return key, "OPSGENIE_API_KEY environment variable", nil
 }
 
-func runWhoIsOnCallCommand(args []string) {
-	// Create flag set for whoisoncall subcommand
-	whoisFlags := flag.NewFlagSet("whoisoncall", flag.ExitOnError)
-	filterFlag := whoisFlags.String("filter", "", "Comma-separated list of schedule names or IDs to filter")
-
-	whoisFlags.Parse(args)
-
-	// Parse filter or use default
-	var filters []string
-
-	// Check if filter flag was explicitly set
-	filterProvided := false
-	for _, arg := range args {
-		if strings.HasPrefix(arg, "-filter") {
-			filterProvided = true
-			break
-		}
+// newClient creates an API client using the key found by resolveAPIKey.
+// The returned cleanup function must be called when the command is done with the client.
+func (cf *clientFlags) newClient() (*opsgenie.Client, func(), error) {
+	if *cf.httpTimeout <= 0 {
+		return nil, nil, validationError("-http-timeout must be positive")
 	}
-
-	if filterProvided && *filterFlag == "" {
-		// User explicitly passed -filter "" to show all schedules
-		filters = []string{}
-	} else if *filterFlag != "" {
-		// User provided specific filters
-		filters = strings.Split(*filterFlag, ",")
-	} else {
-		// Default filter
-		filters = []string{
-			"Archiving Team Schedule",
-			"DIP Ingestion schedule",
-			"DIP Processing schedule",
-			"L1 - Customer Support",
-			"NextGen SRE Team_schedule",
-			"Pathfinder_schedule",
-			"Quantum A-Team schedule",
-			"Quantum S-Team schedule",
-		}
+	if *cf.timeout < 0 {
+		return nil, nil, validationError("-timeout must not be negative")
 	}
 
-	// Get API key from environment variable
-	apiKey := os.Getenv("OPSGENIE_API_KEY")
-	if apiKey == "" {
-		log.Fatal("OPSGENIE_API_KEY environment variable not set.")
+	if cf.fromFile != nil && *cf.fromFile != "" {
+		if *cf.dumpDir != "" {
+			return nil, nil, validationError("-from-file and -dump-dir cannot be used together")
+		}
+		replay, err := opsgenie.LoadReplay(*cf.fromFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		// No API key is needed, since nothing is sent
+		client := opsgenie.NewClient("")
+		client.DetectRegion = false
+		client.Replay = replay
+		return client, func() {}, nil
 	}
 
-	// Create HTTP client
-	client := createHTTPClient()
-
-	// Fetch all schedules
-	schedules, err := fetchAllSchedules(client, apiKey)
+	apiKey, _, err := cf.resolveAPIKey()
 	if err != nil {
-		log.Fatalf("Failed to fetch schedules: %v", err)
+		return nil, nil, err
 	}
-
-	// Filter schedules
-	var filteredSchedules []Schedule
-	for _, schedule := range schedules {
-		if matchesFilter(schedule, filters) {
-			filteredSchedules = append(filteredSchedules, schedule)
+	if *cf.apiKey != "" {
+		log.Printf("Warning: -api-key is visible to other users in the process list; prefer -api-key-file or OPSGENIE_API_KEY")
+	}
+	client := opsgenie.NewClient(apiKey)
+	client.HTTPClient.Timeout = *cf.httpTimeout
+	if *cf.dumpDir != "" {
+		if err := os.MkdirAll(*cf.dumpDir, 0o755); err != nil {
+			return nil, nil, validationError("cannot create dump directory: %v", err)
 		}
+		client.DumpDir = *cf.dumpDir
 	}
 
-	if len(filteredSchedules) == 0 {
-		fmt.Println("No schedules found matching the filter criteria.")
-		return
+	cleanup := func() {}
+	if *cf.retryLog != "" {
+		file, err := os.OpenFile(*cf.retryLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, validationError("cannot open retry log: %v", err)
+		}
+		client.RetryLog = file
+		cleanup = func() { file.Close() }
+	}
+	if *cf.timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), *cf.timeout)
+		client.Context = ctx
+		closeLog := cleanup
+		cleanup = func() {
+			cancel()
+			closeLog()
+		}
 	}
 
-	// Fetch statuses for all filtered schedules
-	statuses := fetchAllScheduleStatuses(client, apiKey, filteredSchedules)
-
-	// Print results
-	printScheduleStatusTable(statuses)
+	return client, cleanup, nil
 }
 
 func main() {
 	if len(os.Args) < 2 {
 		printUsage()
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		<-interrupts
+		os.Exit(exitInterrupted)
+	}()
+
 	subcommand := os.Args[1]
 
+	var err error
 	switch subcommand {
 	case "oncall":
-		runOnCallCommand(os.Args[2:])
+		err = runOnCallCommand(os.Args[2:])
 	case "whoisoncall":
-		runWhoIsOnCallCommand(os.Args[2:])
+		err = runWhoIsOnCallCommand(os.Args[2:])
+	case "whoson":
+		err = runWhoIsOnCommand(os.Args[2:])
+	case "who":
+		err = runWhoCommand(os.Args[2:])
+	case "schedules":
+		err = runSchedulesCommand(os.Args[2:])
+	case "handoffs":
+		err = runHandoffsCommand(os.Args[2:])
+	case "validate-coverage":
+		err = runValidateCoverageCommand(os.Args[2:])
+	case "verify":
+		err = runVerifyCommand(os.Args[2:])
+	case "ics":
+		err = runICSCommand(os.Args[2:])
+	case "alerts":
+		err = runAlertsCommand(os.Args[2:])
+	case "doctor":
+		err = runDoctorCommand(os.Args[2:])
+	case "json-schema":
+		err = runJSONSchemaCommand(os.Args[2:])
+	case "stress":
+		err = runStressCommand(os.Args[2:])
 	case "-h", "--help", "help":
 		printUsage()
 	default:
 		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", subcommand)
 		printUsage()
-		os.Exit(1)
+		os.Exit(exitUsage)
+	}
+
+	if errors.Is(err, errPartialFailure) || errors.Is(err, errHandoffSoon) || errors.Is(err, errCoverageViolations) || errors.Is(err, errRotationDrift) {
+		fmt.Fprintf(os.Stderr, "\nWarning: %v\n", err)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "\nError (%s): %v\n", opsgenie.KindOf(err), err)
 	}
+	os.Exit(exitCode(err))
 }
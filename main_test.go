@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+func TestResolveAPIKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		flag       string
+		file       *string // contents of -api-key-file, nil for no file
+		env        string
+		wantKey    string
+		wantSource string
+		wantErr    bool
+	}{
+		{"flag wins over file and env", "flag-key", ptr("file-key"), "env-key", "flag-key", "-api-key flag, visible in process lists", false},
+		{"file wins over env", "", ptr("file-key"), "env-key", "file-key", "file", false},
+		{"env alone", "", nil, "env-key", "env-key", "OPSGENIE_API_KEY environment variable", false},
+		{"file with trailing newline", "", ptr("file-key\n"), "", "file-key", "file", false},
+		{"file with surrounding whitespace", "", ptr("  file-key \r\n"), "", "file-key", "file", false},
+		{"empty file", "", ptr(""), "env-key", "", "", true},
+		{"whitespace-only file", "", ptr(" \n"), "env-key", "", "", true},
+		{"blank flag falls through", "   ", nil, "env-key", "env-key", "OPSGENIE_API_KEY environment variable", false},
+		{"no key at all", "", nil, "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OPSGENIE_API_KEY", tt.env)
+			path := ""
+			if tt.file != nil {
+				path = filepath.Join(t.TempDir(), "key")
+				if err := os.WriteFile(path, []byte(*tt.file), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cf := &clientFlags{apiKey: &tt.flag, apiKeyFile: &path}
+
+			key, source, err := cf.resolveAPIKey()
+			if tt.wantErr {
+				if opsgenie.KindOf(err) != opsgenie.KindAuth {
+					t.Fatalf("resolveAPIKey() error = %v, want an auth error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantSource == "file" {
+				tt.wantSource = "file " + path
+			}
+			if key != tt.wantKey || source != tt.wantSource {
+				t.Errorf("resolveAPIKey() = %q, %q; want %q, %q", key, source, tt.wantKey, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestResolveAPIKeyMissingFile(t *testing.T) {
+	t.Setenv("OPSGENIE_API_KEY", "env-key")
+	flag, path := "", filepath.Join(t.TempDir(), "missing")
+	cf := &clientFlags{apiKey: &flag, apiKeyFile: &path}
+	if _, _, err := cf.resolveAPIKey(); opsgenie.KindOf(err) != opsgenie.KindAuth {
+		t.Errorf("resolveAPIKey() error = %v, want an auth error instead of falling back to the environment", err)
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// writePrometheusMetrics renders schedule statuses in the Prometheus text exposition format
+func writePrometheusMetrics(w io.Writer, statuses []*opsgenie.ScheduleStatus) {
+	fmt.Fprintln(w, "# HELP opsgenie_schedule_fetch_success Whether the on-call lookup for the schedule succeeded.")
+	fmt.Fprintln(w, "# TYPE opsgenie_schedule_fetch_success gauge")
+	for _, status := range statuses {
+		fmt.Fprintf(w, "opsgenie_schedule_fetch_success{schedule=\"%s\"} %d\n",
+			escapeLabelValue(status.ScheduleName), boolToInt(status.Err == nil))
+	}
+
+	fmt.Fprintln(w, "# HELP opsgenie_schedule_has_oncall Whether anyone is currently on call for the schedule.")
+	fmt.Fprintln(w, "# TYPE opsgenie_schedule_has_oncall gauge")
+	for _, status := range statuses {
+		if status.Err != nil {
+			continue
+		}
+		fmt.Fprintf(w, "opsgenie_schedule_has_oncall{schedule=\"%s\"} %d\n",
+			escapeLabelValue(status.ScheduleName), boolToInt(len(status.CurrentOnCall) > 0))
+	}
+
+	fmt.Fprintln(w, "# HELP opsgenie_shift_ends_in_seconds Seconds until the current on-call shift ends.")
+	fmt.Fprintln(w, "# TYPE opsgenie_shift_ends_in_seconds gauge")
+	for _, status := range statuses {
+		if status.Err != nil || status.ShiftEndsAt.IsZero() {
+			continue
+		}
+		fmt.Fprintf(w, "opsgenie_shift_ends_in_seconds{schedule=\"%s\"} %.0f\n",
+			escapeLabelValue(status.ScheduleName), status.ShiftEndsIn().Seconds())
+	}
+}
+
+// writeOpenMetricsReport renders the hours per person of reports in the OpenMetrics text
+// format, one series per person and schedule in sortMode order, for pushing to a Prometheus
+// Pushgateway
+func writeOpenMetricsReport(w io.Writer, reports []*opsgenie.Report, sortMode string) {
+	fmt.Fprintln(w, "# TYPE opsgenie_oncall_hours counter")
+	fmt.Fprintln(w, "# UNIT opsgenie_oncall_hours hours")
+	fmt.Fprintln(w, "# HELP opsgenie_oncall_hours On-call hours per person over the report range.")
+	for _, report := range reports {
+		for _, pdata := range sortedPeople(report, sortMode) {
+			fmt.Fprintf(w, "opsgenie_oncall_hours_total{schedule=\"%s\",person=\"%s\"} %s\n",
+				escapeLabelValue(report.ScheduleID), escapeLabelValue(pdata.Name), formatMetricValue(pdata.TotalHours))
+		}
+	}
+
+	fmt.Fprintln(w, "# TYPE opsgenie_oncall_coverage_ratio gauge")
+	fmt.Fprintln(w, "# HELP opsgenie_oncall_coverage_ratio Share of the report range with someone on call.")
+	for _, report := range reports {
+		fmt.Fprintf(w, "opsgenie_oncall_coverage_ratio{schedule=\"%s\"} %s\n",
+			escapeLabelValue(report.ScheduleID), formatMetricValue(report.Coverage()/100))
+	}
+	fmt.Fprintln(w, "# EOF")
+}
+
+func formatMetricValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// writeFileAtomically writes the output of render to a temp file next to path and renames
+// it into place, so collectors never read a half-written file
+func writeFileAtomically(path string, render func(w io.Writer)) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	render(tmp)
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp.Name(), err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to move %s into place: %w", path, err)
+	}
+	return nil
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
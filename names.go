@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// normalizeName turns a username or email address into a display name for -normalize-names:
+// the email domain is dropped, dots, underscores and hyphens become spaces and each word is
+// title-cased, so "john.doe@example.com" and "JOHN_DOE" both read "John Doe"
+func normalizeName(raw string) string {
+	name := raw
+	if at := strings.LastIndex(name, "@"); at > 0 {
+		name = name[:at]
+	}
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '.' || r == '_' || r == '-' || unicode.IsSpace(r)
+	})
+	if len(words) == 0 {
+		return raw
+	}
+	for i, word := range words {
+		first, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToUpper(first)) + strings.ToLower(word[size:])
+	}
+	return strings.Join(words, " ")
+}
+
+func normalizeNames(names []string) []string {
+	if names == nil {
+		return nil
+	}
+	normalized := make([]string, len(names))
+	for i, name := range names {
+		normalized[i] = normalizeName(name)
+	}
+	return normalized
+}
+
+// normalizeStatuses returns copies of statuses with display names for everyone in them,
+// for rendering the table; the originals keep the raw recipients for JSON and lookups
+func normalizeStatuses(statuses []*opsgenie.ScheduleStatus) []*opsgenie.ScheduleStatus {
+	normalized := make([]*opsgenie.ScheduleStatus, len(statuses))
+	for i, status := range statuses {
+		copied := *status
+		copied.CurrentOnCall = normalizeNames(status.CurrentOnCall)
+		copied.NextOnCall = normalizeNames(status.NextOnCall)
+		copied.Participants = normalizeNames(status.Participants)
+		normalized[i] = &copied
+	}
+	return normalized
+}
+
+// normalizeReport returns a copy of report keyed by display names. Raw names that only
+// differ in casing or separators belong to one person, so their hours are combined.
+func normalizeReport(report *opsgenie.Report) *opsgenie.Report {
+	normalized := *report
+	normalized.People = make(map[string]*opsgenie.PersonData, len(report.People))
+	for _, pdata := range report.People {
+		name := normalizeName(pdata.Name)
+		total, ok := normalized.People[name]
+		if !ok {
+			total = &opsgenie.PersonData{Name: name, DailyHours: make(map[time.Time]float64)}
+			normalized.People[name] = total
+		}
+		total.TotalHours += pdata.TotalHours
+		total.BusinessHours += pdata.BusinessHours
+		total.OffHours += pdata.OffHours
+		for day, hours := range pdata.DailyHours {
+			total.DailyHours[day] += hours
+		}
+	}
+	return &normalized
+}
@@ -0,0 +1,967 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+func runOnCallCommand(args []string) error {
+	// Create flag set for oncall subcommand
+	oncallFlags := flag.NewFlagSet("oncall", flag.ExitOnError)
+	startDateStr := oncallFlags.String("start", "", "Start date (YYYY-MM-DD), or time (YYYY-MM-DD HH:MM or RFC3339)")
+	endDateStr := oncallFlags.String("end", "", "End date (YYYY-MM-DD, inclusive), or exclusive end time (YYYY-MM-DD HH:MM or RFC3339)")
+	rangesFlag := oncallFlags.String("ranges", "", "Comma-separated START:END ranges (START/END when times contain colons) summed into one report, instead of -start and -end")
+	scheduleID := oncallFlags.String("schedule", "", "OpsGenie schedule ID (UUID) or name, or a comma-separated list of them to combine")
+	bySchedule := oncallFlags.Bool("by-schedule", false, "With several -schedule IDs, print a section per schedule before the combined total")
+	sortMode := oncallFlags.String("sort", "name", "Row order: name, hours (most first), hours-asc (fewest first)")
+	precision := oncallFlags.Int("precision", 2, "Number of decimal places in numeric output")
+	roundMode := oncallFlags.String("round", "none", "Round each person's total before summing: none, hour, half-hour")
+	exact := oncallFlags.Bool("exact", false, "Compute fractional hours from timeline periods instead of hourly sampling")
+	clipToRange := oncallFlags.Bool("clip-to-range", true, "With -exact, only count the part of periods inside the date range")
+	rotation := oncallFlags.String("rotation", "", "With -exact, only count one rotation (ID, name or 1-based position)")
+	expandTeams := oncallFlags.Bool("expand-teams", false, "Credit hours to the members of team recipients instead of the team (hourly sampling only)")
+	format := oncallFlags.String("format", "auto", "Output format: auto (table on a terminal, json when piped), table, json, template, openmetrics")
+	templateFlag := oncallFlags.String("template", "", "Go text/template (or @file) executed against the report; implies -format template")
+	requestInterval := oncallFlags.Duration("request-interval", 750*time.Millisecond, "Pause between hourly on-call requests (0 disables)")
+	hourlyRate := oncallFlags.Float64("hourly-rate", 0, "Hourly on-call rate; adds an estimated cost per person")
+	offHoursMultiplier := oncallFlags.Float64("off-hours-multiplier", 1, "Rate multiplier for hours outside business hours")
+	businessHoursFlag := oncallFlags.String("business-hours", "9-17", "Weekday business hours as START-END hours of day")
+	tz := oncallFlags.String("tz", "UTC", "IANA time zone for classifying business hours (e.g. Europe/London)")
+	maxConcurrent := oncallFlags.Int("max-concurrent", 1, "How many people are expected on call at once; hours with more are reported as overlaps")
+	verbose := oncallFlags.Bool("verbose", false, "List every overlap of concurrent on-call recipients instead of only their total, and log the API rate-limit headers of every request")
+	weekdaysOnly := oncallFlags.Bool("weekdays-only", false, "Leave Saturday and Sunday (in -tz) out of the report, for Monday-Friday rotations")
+	progressLines := oncallFlags.Bool("no-progress-newline", false, "Print progress as separate newline-terminated lines instead of a carriage-return spinner (for log collectors)")
+	jsonIndent := addJSONIndentFlag(oncallFlags)
+	summaryJSON := oncallFlags.String("summary-json", "", "With table output, also write the -format json document to this file, atomically")
+	dateFormat := addDateFormatFlag(oncallFlags)
+	heatmap := oncallFlags.Bool("heatmap", false, "Also print an ASCII heatmap of on-call hours per person and day")
+	byTeam := oncallFlags.Bool("by-team", false, "Also roll hours up per team, from -team-map or the teams API")
+	teamMapPath := oncallFlags.String("team-map", "", "CSV file of person,team rows for -by-team (default: look up team members via the API)")
+	anonymize := oncallFlags.Bool("anonymize", false, "Replace every name with a pseudonym (Person A, Person B, ... by hours) in all output, for sharing reports externally")
+	anonymizeMap := oncallFlags.String("anonymize-map", "", "With -anonymize, write the pseudonym,name mapping to this CSV file for internal reference")
+	normalize := oncallFlags.Bool("normalize-names", false, "Show people as title-cased display names (john.doe@example.com -> John Doe) in the table; JSON keeps the raw values")
+	load := oncallFlags.Bool("load", false, "Also show each person's hours as an FTE share of the range and as weeks of 24/7 coverage")
+	summaryOnly := oncallFlags.Bool("summary-only", false, "Print only the totals, without the per-person breakdown")
+	identityMapPath := oncallFlags.String("identity-map", "", "CSV file of alias,canonical rows used to merge one person's names")
+	excludePerson := oncallFlags.String("exclude-person", "", "Comma-separated case-insensitive regular expressions (plain text matches as a substring) of recipients to leave out, e.g. bot accounts")
+	concurrencyFlag := oncallFlags.String("concurrency", "1", "Number of -schedule IDs to report on concurrently, or auto to adapt to rate limiting")
+	checkpointPath := oncallFlags.String("checkpoint", "", "Periodically save report progress to this file, removed once the report completes")
+	resume := oncallFlags.Bool("resume", false, "Continue from the -checkpoint file of an interrupted run instead of starting over")
+
+	clientOpts := addClientFlags(oncallFlags)
+	clientOpts.addFromFileFlag(oncallFlags)
+
+	oncallFlags.Parse(args)
+
+	// Validate required arguments
+	if *rangesFlag != "" && (*startDateStr != "" || *endDateStr != "") {
+		return validationError("-ranges cannot be combined with -start and -end")
+	}
+	if (*rangesFlag == "" && (*startDateStr == "" || *endDateStr == "")) || *scheduleID == "" {
+		return validationError("start date, end date, and schedule ID must be provided")
+	}
+	var scheduleIDs []string
+	for _, id := range strings.Split(*scheduleID, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			scheduleIDs = append(scheduleIDs, id)
+		}
+	}
+	if len(scheduleIDs) == 0 {
+		return validationError("start date, end date, and schedule ID must be provided")
+	}
+	if *bySchedule && len(scheduleIDs) < 2 {
+		return validationError("-by-schedule requires more than one -schedule ID")
+	}
+	concurrency, autoConcurrency, err := parseConcurrency(*concurrencyFlag, len(scheduleIDs))
+	if err != nil {
+		return err
+	}
+	if *precision < 0 {
+		return validationError("precision must not be negative")
+	}
+	roundStep, err := parseRoundMode(*roundMode)
+	if err != nil {
+		return &opsgenie.Error{Kind: opsgenie.KindValidation, Err: err}
+	}
+	tmpl, err := outputTemplate(format, *templateFlag)
+	if err != nil {
+		return err
+	}
+	*format = resolveFormat(*format, *heatmap || *summaryJSON != "")
+	switch *format {
+	case "table", "json", "template", "openmetrics":
+	default:
+		return validationError("invalid -format value %q (expected auto, table, json, template or openmetrics)", *format)
+	}
+	switch *sortMode {
+	case "name", "hours", "hours-asc":
+	default:
+		return validationError("invalid -sort value %q (expected name, hours or hours-asc)", *sortMode)
+	}
+	if *summaryJSON != "" && *format != "table" {
+		return validationError("-summary-json requires -format table")
+	}
+	if *anonymizeMap != "" && !*anonymize {
+		return validationError("-anonymize-map requires -anonymize")
+	}
+	if *requestInterval < 0 {
+		return validationError("-request-interval must not be negative")
+	}
+	if *heatmap && *format != "table" {
+		return validationError("-heatmap requires -format table")
+	}
+	if *summaryOnly && (*heatmap || *format == "template") {
+		return validationError("-summary-only cannot be combined with -heatmap or -template")
+	}
+	if *teamMapPath != "" && !*byTeam {
+		return validationError("-team-map requires -by-team")
+	}
+	if *byTeam && (*format == "template" || *format == "openmetrics") {
+		return validationError("-by-team is not supported with -template or -format openmetrics")
+	}
+	if *summaryOnly && *format == "openmetrics" {
+		return validationError("-summary-only cannot be combined with -format openmetrics")
+	}
+	if *maxConcurrent < 1 {
+		return validationError("-max-concurrent must be at least 1")
+	}
+	if *hourlyRate < 0 || *offHoursMultiplier < 0 {
+		return validationError("-hourly-rate and -off-hours-multiplier must not be negative")
+	}
+	businessHours, err := parseBusinessHours(*businessHoursFlag, *tz)
+	if err != nil {
+		return err
+	}
+
+	var ranges []reportRange
+	if *rangesFlag != "" {
+		if ranges, err = parseRanges(*rangesFlag); err != nil {
+			return err
+		}
+	} else {
+		single, err := parseReportRange(*startDateStr, *endDateStr)
+		if err != nil {
+			return err
+		}
+		ranges = []reportRange{single}
+	}
+	startDate, rangeEnd := ranges[0].start, ranges[len(ranges)-1].end
+	if len(ranges) > 1 && *checkpointPath != "" {
+		return validationError("-checkpoint is not supported with several -ranges")
+	}
+
+	if *rotation != "" && !*exact {
+		return validationError("-rotation requires -exact")
+	}
+	if *expandTeams && *exact {
+		return validationError("-expand-teams is not supported with -exact")
+	}
+	if *resume && *checkpointPath == "" {
+		return validationError("-resume requires -checkpoint")
+	}
+
+	for _, r := range ranges {
+		for _, transition := range opsgenie.DSTTransitions(r.start, r.end, businessHours.Location) {
+			log.Printf("Note: %v", transition)
+		}
+	}
+
+	var identities map[string]string
+	if *identityMapPath != "" {
+		identities, err = loadIdentityMap(*identityMapPath)
+		if err != nil {
+			return err
+		}
+	}
+	exclude, err := parseExcludePerson(*excludePerson)
+	if err != nil {
+		return err
+	}
+	var memberTeams map[string][]string
+	if *teamMapPath != "" {
+		memberTeams, err = loadTeamMap(*teamMapPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	var checkpoints *checkpointWriter
+	if *checkpointPath != "" {
+		checkpoints = newCheckpointWriter(*checkpointPath, *tz)
+		if *resume {
+			if checkpoints, err = loadCheckpoint(*checkpointPath, *tz); err != nil {
+				return err
+			}
+		}
+	}
+
+	client, cleanup, err := clientOpts.newClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	client.ExpandTeams = *expandTeams
+	if *verbose {
+		client.RateLimitLog = os.Stderr
+		client.RateLimitWarnBelow = rateLimitWarnBelow
+	}
+	if scheduleIDs, err = resolveScheduleIDs(client, scheduleIDs); err != nil {
+		return err
+	}
+	if autoConcurrency {
+		client.AdaptiveConcurrency = maxAutoConcurrency
+	}
+	if *byTeam && memberTeams == nil {
+		// Looked up before the report so a missing teams permission fails fast
+		if memberTeams, err = loadTeamsFromAPI(client); err != nil {
+			return err
+		}
+	}
+
+	reportOpts := opsgenie.ReportOptions{
+		Exact:           *exact,
+		ClipToRange:     *clipToRange,
+		Rotation:        *rotation,
+		Identities:      identities,
+		Exclude:         exclude,
+		BusinessHours:   businessHours,
+		MaxConcurrent:   *maxConcurrent,
+		WeekdaysOnly:    *weekdaysOnly,
+		RequestInterval: *requestInterval,
+	}
+	if *clientOpts.fromFile != "" {
+		// Saved responses are not rate limited
+		reportOpts.RequestInterval = 0
+	}
+	if checkpoints != nil {
+		reportOpts.OnCheckpoint = checkpoints.record
+	}
+	totalSteps := 0
+	for _, r := range ranges {
+		totalSteps += reportOpts.ProgressSteps(r.start, r.end) * len(scheduleIDs)
+	}
+	step := 0
+	var progressMu sync.Mutex
+	resumed := make(map[string]*opsgenie.Checkpoint)
+	if *resume {
+		for _, id := range scheduleIDs {
+			checkpoint, err := checkpoints.resume(id, startDate, rangeEnd, *exact)
+			if err != nil {
+				return err
+			}
+			if checkpoint != nil {
+				resumed[id] = checkpoint
+				// Hours already processed count towards progress
+				step += reportOpts.ProgressSteps(startDate, checkpoint.Next)
+			}
+		}
+	}
+	reportOpts.Progress = func(processed time.Time) {
+		// Progress goes to stderr so stdout stays machine-readable
+		progressMu.Lock()
+		defer progressMu.Unlock()
+		step++
+		if *progressLines {
+			fmt.Fprintf(os.Stderr, "processed %s (%d/%d)\n", processed.Format(time.RFC3339), step, totalSteps)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "\rProcessed date: %s", processed.Format(time.RFC3339))
+	}
+
+	// Each range is reported on separately and joined per schedule afterwards
+	segments := make([][]*opsgenie.Report, len(scheduleIDs))
+	for _, r := range ranges {
+		rangeReports, err := runReports(client, scheduleIDs, r.start, r.end, reportOpts, resumed, concurrency)
+		if err != nil {
+			return err
+		}
+		for i, report := range rangeReports {
+			segments[i] = append(segments[i], report)
+		}
+	}
+	scheduleReports := make([]*opsgenie.Report, len(scheduleIDs))
+	for i, reports := range segments {
+		scheduleReports[i] = reports[0]
+		if len(reports) > 1 {
+			scheduleReports[i] = opsgenie.JoinReports(reports...)
+		}
+	}
+	if checkpoints != nil {
+		checkpoints.remove()
+	}
+
+	// Merge before rounding so combined totals are rounded once per person
+	report := scheduleReports[0]
+	if len(scheduleReports) > 1 {
+		report = opsgenie.MergeReports(scheduleReports...)
+	}
+	sections := []*opsgenie.Report{}
+	if *bySchedule {
+		sections = scheduleReports
+	}
+	totalHours := roundReport(report, roundStep)
+	var teams []teamTotal
+	if *byTeam {
+		teams = teamTotals(report, memberTeams)
+	}
+	if *anonymize {
+		// Every output, including the overlap warnings, only sees the pseudonyms
+		pseudonyms := newPseudonyms(report)
+		report = anonymizeReport(report, pseudonyms)
+		for i, section := range sections {
+			sections[i] = anonymizeReport(section, pseudonyms)
+		}
+		for i := range teams {
+			teams[i].People = anonymizeNames(teams[i].People, pseudonyms)
+		}
+		if *anonymizeMap != "" {
+			var writeErr error
+			err := writeFileAtomically(*anonymizeMap, func(w io.Writer) {
+				writeErr = writePseudonymMap(w, pseudonyms)
+			})
+			if err == nil {
+				err = writeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	// Reported after the output, once the progress line has been ended
+	defer warnOverlaps(report, *maxConcurrent, *verbose, *precision)
+
+	costs := costEstimate{HourlyRate: *hourlyRate, OffHoursMultiplier: *offHoursMultiplier}
+
+	if *format == "template" {
+		if !*progressLines {
+			fmt.Fprintln(os.Stderr)
+		}
+		return executeTemplate(tmpl, report)
+	}
+	// jsonDocument is the -format json output, also written to -summary-json
+	jsonDocument := func() any {
+		out := newReportJSON(report, totalHours, costs, *load, *sortMode)
+		out.Teams = newTeamsJSON(teams)
+		for _, section := range sections {
+			out.Schedules = append(out.Schedules, newReportJSON(section, roundReport(section, roundStep), costs, *load, *sortMode))
+		}
+		if *summaryOnly {
+			return newReportSummaryJSON(out)
+		}
+		return out
+	}
+	if *format == "json" {
+		if !*progressLines {
+			fmt.Fprintln(os.Stderr)
+		}
+		return writeJSON(os.Stdout, jsonDocument(), *jsonIndent)
+	}
+	if *format == "openmetrics" {
+		if !*progressLines {
+			fmt.Fprintln(os.Stderr)
+		}
+		// With -by-schedule each schedule is its own series instead of the combined total
+		metricReports := []*opsgenie.Report{report}
+		if len(sections) > 0 {
+			metricReports = sections
+			for _, section := range sections {
+				roundReport(section, roundStep)
+			}
+		}
+		writeOpenMetricsReport(os.Stdout, metricReports, *sortMode)
+		return nil
+	}
+
+	if *summaryJSON != "" {
+		// Written before -normalize-names, so the file keeps raw names like -format json
+		if err := writeJSONFile(*summaryJSON, jsonDocument()); err != nil {
+			return err
+		}
+	}
+	if *normalize {
+		report = normalizeReport(report)
+		normalizedSections := make([]*opsgenie.Report, len(sections))
+		for i, section := range sections {
+			normalizedSections[i] = normalizeReport(section)
+		}
+		sections = normalizedSections
+	}
+
+	// Print report
+	if !*progressLines {
+		// Move off the carriage-return progress line
+		fmt.Print("\n\n")
+	}
+	fmt.Println("On-Call Report")
+	fmt.Println("==============")
+	dates := humanDates{layout: *dateFormat}
+	labels := make([]string, len(ranges))
+	for i, r := range ranges {
+		labels[i] = r.label(dates)
+	}
+	if len(ranges) == 1 {
+		fmt.Printf("Period: %s\n", labels[0])
+	} else {
+		fmt.Printf("Periods: %s\n", strings.Join(labels, ", "))
+	}
+	if *weekdaysOnly {
+		fmt.Printf("Weekdays only (weekends in %s excluded)\n", businessHours.Location)
+	}
+	for _, section := range sections {
+		fmt.Printf("\nSchedule: %s\n", section.ScheduleID)
+		printReportTable(section, roundReport(section, roundStep), *precision, costs, *summaryOnly, *load, *sortMode)
+	}
+	if len(sections) > 0 {
+		fmt.Println("\nAll schedules combined")
+	}
+	fmt.Println()
+	printReportTable(report, totalHours, *precision, costs, *summaryOnly, *load, *sortMode)
+	if *byTeam {
+		printTeamTable(teams, *precision)
+	}
+	if *heatmap {
+		writeHeatmap(os.Stdout, report, dates)
+	}
+	return nil
+}
+
+// rateLimitWarnBelow is the remaining API rate-limit quota -verbose warns below
+const rateLimitWarnBelow = 10
+
+// maxAutoConcurrency caps the concurrent requests of -concurrency auto
+const maxAutoConcurrency = 8
+
+// parseConcurrency parses -concurrency: a positive number of schedules to report on at
+// once, or "auto" to start every schedule at once and let the client's adaptive limit
+// decide how many requests actually run in parallel
+func parseConcurrency(value string, schedules int) (int, bool, error) {
+	if value == "auto" {
+		return max(1, schedules), true, nil
+	}
+	concurrency, err := strconv.Atoi(value)
+	if err != nil || concurrency < 1 {
+		return 0, false, validationError("invalid -concurrency value %q (expected a positive number or auto)", value)
+	}
+	return concurrency, false, nil
+}
+
+// runReports runs the report of every schedule, up to concurrency at a time. Reports
+// come back in scheduleIDs order whatever order they finish in; the first failure (in that
+// order) is returned once running reports are done, and stops further ones from starting.
+func runReports(client *opsgenie.Client, scheduleIDs []string, start, end time.Time, opts opsgenie.ReportOptions,
+	resumed map[string]*opsgenie.Checkpoint, concurrency int) ([]*opsgenie.Report, error) {
+	reports := make([]*opsgenie.Report, len(scheduleIDs))
+	errs := make([]error, len(scheduleIDs))
+	semaphore := make(chan struct{}, concurrency)
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+
+	for i, id := range scheduleIDs {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			if failed.Load() {
+				return
+			}
+
+			scheduleOpts := opts
+			scheduleOpts.Resume = resumed[id]
+			reports[i], errs[i] = client.Report(id, start, end, scheduleOpts)
+			if errs[i] != nil {
+				failed.Store(true)
+			}
+		}(i, id)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return reports, nil
+}
+
+// warnOverlaps logs how long more than maxConcurrent people were on call at once, a sign
+// of a misconfigured rotation or a forgotten override, and with verbose each overlap
+func warnOverlaps(report *opsgenie.Report, maxConcurrent int, verbose bool, precision int) {
+	if len(report.Overlaps) == 0 {
+		return
+	}
+	hint := "; rerun with -verbose to list them"
+	if verbose {
+		hint = ":"
+	}
+	log.Printf("Warning: %.*f hours had multiple concurrent on-call recipients (more than %d)%s",
+		precision, report.OverlapHours(), maxConcurrent, hint)
+	if !verbose {
+		return
+	}
+	multipleSchedules := strings.Contains(report.ScheduleID, ",")
+	for _, overlap := range report.Overlaps {
+		schedule := ""
+		if multipleSchedules {
+			schedule = " [" + overlap.ScheduleID + "]"
+		}
+		log.Printf("  %s to %s%s: %s", overlap.Start.Format(time.RFC3339), overlap.End.Format(time.RFC3339),
+			schedule, strings.Join(overlap.People, ", "))
+	}
+}
+
+// roundReport rounds each person's total in place and returns the sum of the rounded totals.
+// The business hours are rounded too and the off-hours are what remains of the rounded
+// total, so the split still adds up to it in every output and in the cost.
+func roundReport(report *opsgenie.Report, step float64) float64 {
+	var totalHours float64
+	for _, pdata := range report.People {
+		if step > 0 {
+			pdata.TotalHours = roundHours(pdata.TotalHours, step)
+			pdata.BusinessHours = min(roundHours(pdata.BusinessHours, step), pdata.TotalHours)
+			pdata.OffHours = pdata.TotalHours - pdata.BusinessHours
+		}
+		totalHours += pdata.TotalHours
+	}
+	return totalHours
+}
+
+// printReportTable prints the per-person table, in sortMode order, and totals of one
+// report, or with summaryOnly just the totals. With load, each person also gets their FTE
+// share of the range and the weeks of 24/7 coverage their hours amount to.
+func printReportTable(report *opsgenie.Report, totalHours float64, precision int, costs costEstimate, summaryOnly, load bool, sortMode string) {
+	totalDays := totalHours / 24
+	totalWeeks := totalDays / 7
+
+	loadHeader, loadWidth := "", 0
+	if load {
+		loadHeader, loadWidth = fmt.Sprintf(" %-12s %-12s", "FTE", "24/7 Weeks"), 26
+	}
+	switch {
+	case summaryOnly:
+	case costs.enabled():
+		fmt.Printf("%-40s %-15s %-15s %-15s %-15s%s\n", "Name", "Total Hours", "Business", "Off-Hours", "Cost", loadHeader)
+		fmt.Println(strings.Repeat("-", 104+loadWidth))
+	default:
+		fmt.Printf("%-40s %-15s%s\n", "Name", "Total Hours", loadHeader)
+		fmt.Println(strings.Repeat("-", 61+loadWidth))
+	}
+	var totalCost float64
+	for _, pdata := range sortedPeople(report, sortMode) {
+		loadCells := ""
+		if load {
+			loadCells = fmt.Sprintf(" %-12.*f %-12.*f", precision, fte(report, pdata.TotalHours), precision, pdata.TotalHours/hoursPerWeek)
+		}
+		if costs.enabled() {
+			cost := costs.of(pdata)
+			totalCost += cost
+			if !summaryOnly {
+				fmt.Printf("%s %-15.*f %-15.*f %-15.*f %-15.*f%s\n", padRight(pdata.Name, 40), precision, pdata.TotalHours,
+					precision, pdata.BusinessHours, precision, pdata.OffHours, precision, cost, loadCells)
+			}
+			continue
+		}
+		if !summaryOnly {
+			fmt.Printf("%s %-15.*f%s\n", padRight(pdata.Name, 40), precision, pdata.TotalHours, loadCells)
+		}
+	}
+	if !summaryOnly {
+		fmt.Println("\n-------------------------------------------------------------")
+	}
+	fmt.Printf("Total Hours: %.*f\n", precision, totalHours)
+	fmt.Printf("Total Days: %.*f\n", precision, totalDays)
+	fmt.Printf("Total 7-Day Weeks: %.*f\n", precision, totalWeeks)
+	fmt.Printf("Coverage: %.*f%%\n", precision, report.Coverage())
+	if len(report.ExcludedHours) > 0 {
+		names := make([]string, 0, len(report.ExcludedHours))
+		for name := range report.ExcludedHours {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Printf("Excluded Hours: %.*f (%s)\n", precision, report.TotalExcludedHours(), strings.Join(names, ", "))
+	}
+	if costs.enabled() {
+		fmt.Printf("Total Estimated Cost: %.*f\n", precision, totalCost)
+	}
+}
+
+// sortedPeople returns the people of a report in -sort order: by name, by hours descending
+// ("hours") or by hours ascending ("hours-asc"); ties always fall back to the name
+func sortedPeople(report *opsgenie.Report, mode string) []*opsgenie.PersonData {
+	people := make([]*opsgenie.PersonData, 0, len(report.People))
+	for _, pdata := range report.People {
+		people = append(people, pdata)
+	}
+	sort.Slice(people, func(i, j int) bool {
+		a, b := people[i], people[j]
+		if a.TotalHours != b.TotalHours {
+			switch mode {
+			case "hours":
+				return a.TotalHours > b.TotalHours
+			case "hours-asc":
+				return a.TotalHours < b.TotalHours
+			}
+		}
+		return a.Name < b.Name
+	})
+	return people
+}
+
+// hoursPerWeek is one week of 24/7 coverage
+const hoursPerWeek = 7 * 24
+
+// fte expresses on-call hours as a share of the report range, e.g. 0.2 for someone on call
+// a fifth of the time, so load is comparable across ranges of different length
+func fte(report *opsgenie.Report, hours float64) float64 {
+	rangeHours := report.RangeHours()
+	if rangeHours <= 0 {
+		return 0
+	}
+	return hours / rangeHours
+}
+
+// costEstimate prices on-call hours, with off-hours paid at a multiple of the hourly rate
+type costEstimate struct {
+	HourlyRate         float64
+	OffHoursMultiplier float64
+}
+
+func (c costEstimate) enabled() bool {
+	return c.HourlyRate > 0
+}
+
+// of prices the hours of pdata as printed, so it is called after roundReport: with -round the
+// cost follows the rounded business and off-hours rather than the exact ones
+func (c costEstimate) of(pdata *opsgenie.PersonData) float64 {
+	return c.HourlyRate * (pdata.BusinessHours + pdata.OffHours*c.OffHoursMultiplier)
+}
+
+// parseBusinessHours parses a START-END hour range such as "9-17" in the named time zone
+func parseBusinessHours(value, tz string) (opsgenie.BusinessHours, error) {
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return opsgenie.BusinessHours{}, validationError("invalid -tz %q: %v", tz, err)
+	}
+	var start, end int
+	if _, err := fmt.Sscanf(value, "%d-%d", &start, &end); err != nil || start < 0 || end > 24 || start >= end {
+		return opsgenie.BusinessHours{}, validationError("invalid -business-hours %q (expected START-END hours, e.g. 9-17)", value)
+	}
+	return opsgenie.BusinessHours{Start: start, End: end, Location: loc}, nil
+}
+
+// loadIdentityMap reads alias,canonical rows from a CSV file. Aliases are matched
+// case-insensitively; blank lines and lines starting with # are ignored.
+func loadIdentityMap(path string) (map[string]string, error) {
+	identities := make(map[string]string)
+	err := readNamePairs(path, "identity map", func(alias, canonical string) {
+		identities[strings.ToLower(alias)] = canonical
+	})
+	return identities, err
+}
+
+// parseExcludePerson compiles the comma-separated -exclude-person patterns into a matcher,
+// or nil when there are none. Patterns are case-insensitive regular expressions, so plain
+// text such as "bot" matches anywhere in a name.
+func parseExcludePerson(value string) (func(name string) bool, error) {
+	var patterns []*regexp.Regexp
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		pattern, err := regexp.Compile("(?i)" + entry)
+		if err != nil {
+			return nil, validationError("invalid -exclude-person pattern %q: %v", entry, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	return func(name string) bool {
+		for _, pattern := range patterns {
+			if pattern.MatchString(name) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// loadTeamMap reads person,team rows from a CSV file into lower-cased person -> teams.
+// A person may be listed once per team they belong to.
+func loadTeamMap(path string) (map[string][]string, error) {
+	teams := make(map[string][]string)
+	err := readNamePairs(path, "team map", func(person, team string) {
+		teams[strings.ToLower(person)] = append(teams[strings.ToLower(person)], team)
+	})
+	return teams, err
+}
+
+// readNamePairs calls add for every two-column row of a CSV file with both columns set,
+// skipping blank lines and lines starting with #
+func readNamePairs(path, description string, add func(first, second string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return validationError("cannot open %s: %v", description, err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return validationError("invalid %s %s: %v", description, path, err)
+		}
+		first, second := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if first == "" || second == "" {
+			continue
+		}
+		add(first, second)
+	}
+	return nil
+}
+
+// resolveScheduleIDs turns each -schedule entry into a schedule ID: IDs are kept, and
+// schedule names (case-insensitive) are replaced by their ID. An entry matching neither
+// fails with the closest schedule names. When the schedules cannot be listed for another
+// reason than a rejected key, the entries are used as given.
+func resolveScheduleIDs(client *opsgenie.Client, entries []string) ([]string, error) {
+	schedules, err := client.Schedules()
+	if opsgenie.KindOf(err) == opsgenie.KindAuth {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("Warning: cannot list schedules to check -schedule, using it as given: %v", err)
+		return entries, nil
+	}
+
+	ids := make([]string, 0, len(entries))
+	var unknown []string
+	for _, entry := range entries {
+		id := ""
+		for _, schedule := range schedules {
+			if strings.EqualFold(schedule.ID, entry) {
+				id = schedule.ID
+				break
+			}
+			if id == "" && strings.EqualFold(schedule.Name, entry) {
+				id = schedule.ID
+			}
+		}
+		if id == "" {
+			unknown = append(unknown, fmt.Sprintf("schedule %q not found%s", entry, didYouMean(suggestSchedules(entry, schedules))))
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(unknown) > 0 {
+		return nil, validationError("%s", strings.Join(unknown, "\n"))
+	}
+	return ids, nil
+}
+
+// loadTeamsFromAPI maps the lower-cased username of every team member to their teams
+func loadTeamsFromAPI(client *opsgenie.Client) (map[string][]string, error) {
+	teams, err := client.Teams()
+	if err != nil {
+		return nil, err
+	}
+	memberTeams := make(map[string][]string)
+	for _, team := range teams {
+		members, err := client.TeamMembers(team.ID, team.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			memberTeams[strings.ToLower(member)] = append(memberTeams[strings.ToLower(member)], team.Name)
+		}
+	}
+	return memberTeams, nil
+}
+
+// noTeam is the team of people missing from the team map
+const noTeam = "(no team)"
+
+// teamTotal is the on-call hours of one team's members in a report
+type teamTotal struct {
+	Name          string
+	Hours         float64
+	BusinessHours float64
+	OffHours      float64
+	People        []string // sorted
+}
+
+// teamTotals rolls the people of report up into teams, sorted by hours (most first). A
+// person in several teams counts fully towards each, so team hours can add up to more
+// than the report total.
+func teamTotals(report *opsgenie.Report, memberTeams map[string][]string) []teamTotal {
+	byName := make(map[string]*teamTotal)
+	for _, pdata := range report.People {
+		teams := memberTeams[strings.ToLower(pdata.Name)]
+		if len(teams) == 0 {
+			teams = []string{noTeam}
+		}
+		for _, team := range teams {
+			total, ok := byName[team]
+			if !ok {
+				total = &teamTotal{Name: team}
+				byName[team] = total
+			}
+			total.Hours += pdata.TotalHours
+			total.BusinessHours += pdata.BusinessHours
+			total.OffHours += pdata.OffHours
+			total.People = append(total.People, pdata.Name)
+		}
+	}
+
+	totals := make([]teamTotal, 0, len(byName))
+	for _, total := range byName {
+		sort.Strings(total.People)
+		totals = append(totals, *total)
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].Hours != totals[j].Hours {
+			return totals[i].Hours > totals[j].Hours
+		}
+		return totals[i].Name < totals[j].Name
+	})
+	return totals
+}
+
+// printTeamTable prints the hours per team
+func printTeamTable(totals []teamTotal, precision int) {
+	fmt.Println("\nHours by Team")
+	fmt.Printf("%-40s %-15s %s\n", "Team", "Total Hours", "People")
+	fmt.Println("-------------------------------------------------------------")
+	for _, total := range totals {
+		fmt.Printf("%s %-15.*f %d\n", padRight(truncate(total.Name, 40), 40), precision, total.Hours, len(total.People))
+	}
+}
+
+// parseRoundMode returns the rounding step in hours for the -round flag (0 means no rounding)
+func parseRoundMode(mode string) (float64, error) {
+	switch mode {
+	case "none", "":
+		return 0, nil
+	case "hour":
+		return 1, nil
+	case "half-hour":
+		return 0.5, nil
+	default:
+		return 0, fmt.Errorf("invalid -round value %q (expected none, hour or half-hour)", mode)
+	}
+}
+
+func roundHours(hours, step float64) float64 {
+	if step <= 0 {
+		return hours
+	}
+	return math.Round(hours/step) * step
+}
+
+// reportRange is the range of -start and -end, or one of -ranges
+type reportRange struct {
+	start, end time.Time // end is exclusive
+	lastDay    time.Time // the end as given, the last day covered when it is a date
+	timed      bool      // start or end was given with a time of day
+}
+
+// label describes the range for the report header, as dates unless it was given as times
+func (r reportRange) label(dates humanDates) string {
+	if r.timed {
+		return dates.time(r.start) + " to " + dates.time(r.end)
+	}
+	return dates.date(r.start) + " to " + dates.date(r.lastDay)
+}
+
+// parseReportRange parses a start and end in UTC; a date-only end covers that whole day
+func parseReportRange(startValue, endValue string) (reportRange, error) {
+	start, startHasTime, err := parseRangeTime(startValue)
+	if err != nil {
+		return reportRange{}, validationError("invalid start date format: %v", err)
+	}
+	lastDay, endHasTime, err := parseRangeTime(endValue)
+	if err != nil {
+		return reportRange{}, validationError("invalid end date format: %v", err)
+	}
+	end := lastDay
+	if !endHasTime {
+		end = lastDay.AddDate(0, 0, 1)
+	}
+	if !end.After(start) {
+		return reportRange{}, validationError("end must be after start")
+	}
+	return reportRange{start: start, end: end, lastDay: lastDay, timed: startHasTime || endHasTime}, nil
+}
+
+// parseRanges parses -ranges: comma-separated START:END pairs, or START/END when the values
+// contain colons themselves, each as for -start and -end. The ranges are returned in time
+// order and must not overlap.
+func parseRanges(value string) ([]reportRange, error) {
+	var ranges []reportRange
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		startValue, endValue, ok := strings.Cut(entry, "/")
+		if !ok {
+			if strings.Count(entry, ":") != 1 {
+				return nil, validationError("invalid -ranges entry %q (expected START:END, or START/END when times contain colons)", entry)
+			}
+			startValue, endValue, _ = strings.Cut(entry, ":")
+		}
+		r, err := parseReportRange(startValue, endValue)
+		if err != nil {
+			return nil, validationError("-ranges entry %q: %v", entry, err)
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, validationError("-ranges lists no ranges")
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start.Before(ranges[j].start)
+	})
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i].start.Before(ranges[i-1].end) {
+			return nil, validationError("-ranges overlap: %s to %s and %s to %s",
+				ranges[i-1].start.Format(time.RFC3339), ranges[i-1].end.Format(time.RFC3339),
+				ranges[i].start.Format(time.RFC3339), ranges[i].end.Format(time.RFC3339))
+		}
+	}
+	return ranges, nil
+}
+
+// rangeTimeLayouts are the accepted -start/-end formats; all but the last carry a time of day
+var rangeTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"}
+
+// parseRangeTime parses a -start/-end value in UTC and reports whether it included a time of day
+func parseRangeTime(value string) (time.Time, bool, error) {
+	for i, layout := range rangeTimeLayouts {
+		if parsed, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return parsed.UTC(), i < len(rangeTimeLayouts)-1, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("%q is not YYYY-MM-DD, YYYY-MM-DD HH:MM or RFC3339", value)
+}
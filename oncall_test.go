@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// scheduleTimelines serves the timeline of each schedule ID from its periods, one person per
+// period in a single rotation. With arrivals set, every timeline request waits until that
+// many have arrived (or a second passes), proving the reports run at the same time.
+func scheduleTimelines(t *testing.T, periods map[string][][2]time.Time, people map[string]string, arrivals int) *opsgenie.Client {
+	t.Helper()
+	var barrier sync.WaitGroup
+	barrier.Add(arrivals)
+	var once sync.Map
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/schedules/"), "/timeline")
+		if _, ok := periods[id]; !ok {
+			http.Error(w, `{"message":"boom"}`, http.StatusBadRequest)
+			return
+		}
+		if _, seen := once.LoadOrStore(id, true); !seen && arrivals > 0 {
+			barrier.Done()
+			waited := make(chan struct{})
+			go func() { barrier.Wait(); close(waited) }()
+			select {
+			case <-waited:
+			case <-time.After(time.Second):
+				t.Errorf("schedule %s: reports did not run concurrently", id)
+			}
+		}
+		rotation := opsgenie.TimelineRotation{ID: "r1", Name: "Primary"}
+		for _, p := range periods[id] {
+			rotation.Periods = append(rotation.Periods, opsgenie.RotationPeriod{
+				StartDate: p[0].Format(time.RFC3339),
+				EndDate:   p[1].Format(time.RFC3339),
+				Recipient: opsgenie.Recipient{Name: people[id]},
+			})
+		}
+		var resp opsgenie.TimelineResponse
+		resp.Data.FinalTimeline.Rotations = []opsgenie.TimelineRotation{rotation}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := opsgenie.NewClient("test-key")
+	client.BaseURL = srv.URL
+	client.DetectRegion = false
+	return client
+}
+
+func TestRunReportsConcurrently(t *testing.T) {
+	day := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	hour := func(h float64) time.Time { return day.Add(time.Duration(h * float64(time.Hour))) }
+	periods := map[string][][2]time.Time{
+		"s1": {{hour(0), hour(8)}},
+		"s2": {{hour(8), hour(12.5)}, {hour(20), hour(24)}},
+		"s3": {{hour(0), hour(24)}},
+	}
+	people := map[string]string{"s1": "alice", "s2": "bob", "s3": "alice"}
+	ids := []string{"s1", "s2", "s3"}
+	client := scheduleTimelines(t, periods, people, len(ids))
+
+	reports, err := runReports(client, ids, day, day.AddDate(0, 0, 1), opsgenie.ReportOptions{Exact: true, ClipToRange: true}, nil, len(ids))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, report := range reports {
+		if report.ScheduleID != ids[i] {
+			t.Errorf("report %d is for %s, want %s", i, report.ScheduleID, ids[i])
+		}
+	}
+
+	merged := opsgenie.MergeReports(reports...)
+	want := map[string]float64{"alice": 32, "bob": 8.5}
+	if len(merged.People) != len(want) {
+		t.Errorf("people = %v, want %v", merged.People, want)
+	}
+	for name, hours := range want {
+		if pdata := merged.People[name]; pdata == nil || math.Abs(pdata.TotalHours-hours) > 1e-9 {
+			t.Errorf("%s: %+v, want %v hours", name, pdata, hours)
+		}
+	}
+	if total := merged.TotalHours(); math.Abs(total-40.5) > 1e-9 {
+		t.Errorf("total = %v, want 40.5", total)
+	}
+	// Coverage is the mean of 8/24, 8.5/24 and 24/24
+	if coverage := merged.Coverage(); math.Abs(coverage-(8+8.5+24)/72*100) > 1e-9 {
+		t.Errorf("coverage = %v", coverage)
+	}
+	if merged.ScheduleID != "s1,s2,s3" {
+		t.Errorf("merged schedule ID = %q", merged.ScheduleID)
+	}
+}
+
+func TestRunReportsFailure(t *testing.T) {
+	day := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	periods := map[string][][2]time.Time{"s1": {{day, day.Add(time.Hour)}}, "s3": {{day, day.Add(time.Hour)}}}
+	client := scheduleTimelines(t, periods, map[string]string{"s1": "alice", "s3": "bob"}, 0)
+
+	reports, err := runReports(client, []string{"s1", "missing", "s3"}, day, day.AddDate(0, 0, 1), opsgenie.ReportOptions{Exact: true}, nil, 2)
+	if err == nil || reports != nil {
+		t.Fatalf("runReports() = %v, %v; want the failure of the missing schedule", reports, err)
+	}
+}
+
+func TestRoundReport(t *testing.T) {
+	tests := []struct {
+		name                        string
+		step                        float64
+		total, business, off        float64 // before rounding
+		wantTotal, wantBus, wantOff float64
+	}{
+		{"none", 0, 8.4, 5.5, 2.9, 8.4, 5.5, 2.9},
+		{"hour", 1, 8.4, 5.5, 2.9, 8, 6, 2},
+		{"half-hour", 0.5, 8.4, 5.5, 2.9, 8.5, 5.5, 3},
+		{"business takes the rounded hour", 1, 1.4, 0.7, 0.7, 1, 1, 0},
+		{"rounds to nothing", 1, 0.4, 0.2, 0.2, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pdata := &opsgenie.PersonData{Name: "alice", TotalHours: tt.total, BusinessHours: tt.business, OffHours: tt.off}
+			report := &opsgenie.Report{People: map[string]*opsgenie.PersonData{"alice": pdata}}
+			if total := roundReport(report, tt.step); math.Abs(total-tt.wantTotal) > 1e-9 {
+				t.Errorf("roundReport() = %v, want %v", total, tt.wantTotal)
+			}
+			if math.Abs(pdata.TotalHours-tt.wantTotal) > 1e-9 || math.Abs(pdata.BusinessHours-tt.wantBus) > 1e-9 || math.Abs(pdata.OffHours-tt.wantOff) > 1e-9 {
+				t.Errorf("rounded to %v = %v business + %v off, want %v = %v + %v",
+					pdata.TotalHours, pdata.BusinessHours, pdata.OffHours, tt.wantTotal, tt.wantBus, tt.wantOff)
+			}
+		})
+	}
+}
+
+func TestCostOfRoundedReport(t *testing.T) {
+	pdata := &opsgenie.PersonData{Name: "alice", TotalHours: 8.4, BusinessHours: 5.5, OffHours: 2.9}
+	report := &opsgenie.Report{People: map[string]*opsgenie.PersonData{"alice": pdata}}
+	total := roundReport(report, 1)
+	costs := costEstimate{HourlyRate: 10, OffHoursMultiplier: 1.5}
+	// 6 business hours at 10 and 2 off-hours at 15, as printed after rounding 8.4 to 8
+	const want = 90
+
+	if cost := costs.of(pdata); math.Abs(cost-want) > 1e-9 {
+		t.Errorf("cost = %v, want %v", cost, want)
+	}
+	out := newReportJSON(report, total, costs, false, "name")
+	person := out.People[0]
+	if person.Hours != 8 || person.BusinessHours != 6 || person.OffHours != 2 || person.Cost == nil || math.Abs(*person.Cost-want) > 1e-9 {
+		t.Errorf("JSON person = %+v, want 8 = 6 + 2 hours costing %v", person, want)
+	}
+	if out.TotalCost == nil || math.Abs(*out.TotalCost-want) > 1e-9 {
+		t.Errorf("JSON total cost = %v, want %v", out.TotalCost, want)
+	}
+	table := captureStdout(t, func() { printReportTable(report, total, 2, costs, false, false, "name") })
+	if !strings.Contains(table, "8.00            6.00            2.00            90.00") || !strings.Contains(table, "Total Estimated Cost: 90.00") {
+		t.Errorf("table does not show 8 = 6 + 2 hours costing 90:\n%s", table)
+	}
+}
@@ -0,0 +1,30 @@
+package opsgenie
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// alertsPageSize is the largest page the alerts API returns
+const alertsPageSize = 100
+
+// OpenAlerts lists open alerts, newest first, following pagination until limit alerts have
+// been fetched or there are no more
+func (c *Client) OpenAlerts(limit int) ([]Alert, error) {
+	var alerts []Alert
+	for offset := 0; offset < limit; offset += alertsPageSize {
+		pageSize := min(alertsPageSize, limit-offset)
+		path := fmt.Sprintf("/alerts?query=%s&limit=%d&offset=%d&sort=createdAt&order=desc",
+			url.QueryEscape("status: open"), pageSize, offset)
+
+		var alertsResp AlertsResponse
+		if err := c.getJSON(path, &alertsResp); err != nil {
+			return nil, fmt.Errorf("failed to fetch alerts: %w", err)
+		}
+		alerts = append(alerts, alertsResp.Data...)
+		if len(alertsResp.Data) < pageSize || alertsResp.Paging.Next == "" {
+			break
+		}
+	}
+	return alerts, nil
+}
@@ -0,0 +1,63 @@
+package opsgenie
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// circuitBreaker counts consecutive failed requests (network errors and 5xx responses).
+// Once the count reaches the threshold the circuit opens and requests fail immediately;
+// after the cooldown a single probe request is let through (half-open) and its outcome
+// closes or re-opens the circuit.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// allow returns an error when the circuit is open or a half-open probe is already in flight,
+// and otherwise whether the request it lets through is that probe
+func (b *circuitBreaker) allow(threshold int) (bool, error) {
+	if threshold <= 0 {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < threshold {
+		return false, nil
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false, &Error{Kind: KindNetwork, Err: fmt.Errorf("%w: %d consecutive failed requests, retrying after %s",
+			ErrCircuitOpen, b.failures, b.openUntil.Format(time.RFC3339))}
+	}
+	b.probing = true
+	return true, nil
+}
+
+// release ends a request let through by allow that has no outcome to record, such as one
+// cancelled by our own deadline, so a half-open probe never keeps the circuit open for good
+func (b *circuitBreaker) release(probe bool) {
+	if !probe {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// record notes the outcome of a request let through by allow
+func (b *circuitBreaker) record(success bool, threshold int, cooldown time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if success {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if threshold > 0 && b.failures >= threshold {
+		b.openUntil = time.Now().Add(cooldown)
+	}
+}
@@ -0,0 +1,479 @@
+// Package opsgenie queries OpsGenie schedules and aggregates on-call hours.
+package opsgenie
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBaseURL is the OpsGenie REST API root for the US instance
+const DefaultBaseURL = "https://api.opsgenie.com/v2"
+
+// EUBaseURL is the OpsGenie REST API root for the EU instance
+const EUBaseURL = "https://api.eu.opsgenie.com/v2"
+
+// Client talks to the OpsGenie REST API with a single API key.
+// Fields may be adjusted after NewClient and before the first request.
+type Client struct {
+	APIKey     string
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// Context, if set, bounds every request made through the Client: once it is done,
+	// waiting and in-flight requests fail with an error wrapping its error, and Statuses
+	// stops waiting for the schedules it has not heard back from
+	Context context.Context
+
+	// DetectRegion retries the first request rejected with 401 against the other region
+	// (US or EU) when BaseURL is one of them, and keeps using that region if it accepts the key
+	DetectRegion  bool
+	regionMu      sync.Mutex
+	regionChecked bool
+
+	// MaxRetries is how many times a rate-limited (HTTP 429) request is retried
+	MaxRetries int
+	// InitialBackoff is the wait before the first retry; it doubles on every further retry.
+	// Each wait is jittered to between half and all of the backoff so concurrent requests
+	// that were rate limited together do not retry in lockstep. A Retry-After header on the
+	// 429 response takes precedence.
+	InitialBackoff time.Duration
+
+	// AdaptiveConcurrency, if positive, caps how many requests are in flight at once with a
+	// limit that starts at 1, grows by one while requests succeed without rate limiting and
+	// halves on every 429 (AIMD), never exceeding this value
+	AdaptiveConcurrency int
+	limiter             adaptiveLimiter
+
+	// A 429 on any request pauses the start of every request made through the Client until
+	// pausedUntil, so concurrent fetches back off together instead of tripping the limit
+	pauseMu     sync.Mutex
+	pausedUntil time.Time
+
+	// BreakerThreshold is how many consecutive network errors or 5xx responses open the
+	// circuit, after which requests fail fast with ErrCircuitOpen; 0 disables the breaker
+	BreakerThreshold int
+	// BreakerCooldown is how long the circuit stays open before one probe request is allowed
+	BreakerCooldown time.Duration
+	breaker         circuitBreaker
+
+	// ExpandTeams makes OnCall replace team recipients with their member users
+	ExpandTeams bool
+	// RecipientType, if set, makes OnCall only return participants of that type: "user",
+	// "team" or "escalation"
+	RecipientType string
+	// IncludeParticipants makes Status also list everyone in the schedule's rotations, not
+	// just who is on call now
+	IncludeParticipants bool
+	// Rotation, if set, makes Status only report one rotation of each schedule, selected as
+	// by MatchesRotation, working out who is on call from the timeline instead of the
+	// on-calls API
+	Rotation string
+	// EmptyRetryDelay, if positive, makes OnCall query once more after this delay when no
+	// one is on call, since the API can briefly return no recipients right at a handoff
+	EmptyRetryDelay time.Duration
+
+	// RetryLog, if set, receives one tab-separated line (timestamp, URL, attempts, final
+	// status) for every request that needed at least one retry
+	RetryLog   io.Writer
+	retryLogMu sync.Mutex
+
+	// DumpDir, if set, is a directory that receives the body of every successful response,
+	// one file per request path, for replaying with LoadReplay
+	DumpDir string
+	// Replay, if set, answers every request from saved responses instead of the network;
+	// a request with no saved response fails with a network error
+	Replay *Replay
+
+	// RateLimitLog, if set, receives one tab-separated line (timestamp, URL, X-RateLimit-*
+	// headers) for every response that carries rate-limit headers
+	RateLimitLog io.Writer
+	// RateLimitWarnBelow, if positive, logs a warning whenever a response's
+	// X-RateLimit-Remaining header drops below it
+	RateLimitWarnBelow int
+
+	rateLimitMu    sync.Mutex
+	rateLimitState string // X-RateLimit-State of the latest response that had one
+
+	teamMu    sync.Mutex
+	teamCache map[string][]string // team ID or name -> member usernames
+}
+
+// NewClient returns a Client authenticating with apiKey using the default endpoint and retry policy
+func NewClient(apiKey string) *Client {
+	return &Client{
+		APIKey:       apiKey,
+		BaseURL:      DefaultBaseURL,
+		DetectRegion: true,
+		HTTPClient: &http.Client{
+			Timeout: time.Second * 30,
+		},
+		MaxRetries:       5,
+		InitialBackoff:   time.Second * 2,
+		BreakerThreshold: 5,
+		BreakerCooldown:  time.Second * 30,
+	}
+}
+
+// maxErrorBody caps how much of a non-200 response body is read into the error message
+const maxErrorBody = 64 << 10
+
+// bodyBuffers recycles response body buffers between requests, so repeated large
+// responses (timelines of big accounts, watch-mode refreshes) do not regrow a fresh
+// buffer every time
+var bodyBuffers = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// IdempotencyKeyHeader marks a POST as safe to send again: the server applies requests
+// carrying the same key only once
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// request is one logical API request. Its body is sent anew on every attempt.
+type request struct {
+	method string
+	path   string // relative to the API base URL
+	body   []byte
+	header http.Header
+}
+
+// retryable reports whether req may be sent again after a rate-limited attempt: idempotent
+// methods always, POST only with an idempotency key, since replaying a plain POST could
+// apply it twice
+func (req request) retryable() bool {
+	switch req.method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return req.header.Get(IdempotencyKeyHeader) != ""
+	default:
+		return false
+	}
+}
+
+// get performs a GET request against path (relative to the API base URL), see do
+func (c *Client) get(path string, decode func(body []byte) error) error {
+	return c.do(request{method: http.MethodGet, path: path}, decode)
+}
+
+// do performs req, retrying with exponential backoff when rate limited and req is
+// retryable, and passes the body of the 2xx response to decode. The body is only valid
+// during the call.
+func (c *Client) do(req request, decode func(body []byte) error) error {
+	if c.Replay != nil {
+		// Only GET responses are saved, and nothing else may leave the machine when replaying
+		body, ok := c.Replay.response(req.path)
+		if !ok || req.method != http.MethodGet {
+			return &Error{Kind: KindNetwork, Err: fmt.Errorf("no saved response for %s %s", req.method, req.path)}
+		}
+		return decode(body)
+	}
+
+	c.regionMu.Lock()
+	baseURL := c.BaseURL
+	c.regionMu.Unlock()
+
+	err := c.doFrom(baseURL, req, decode)
+	if KindOf(err) != KindAuth || !c.DetectRegion {
+		return err
+	}
+
+	// The key may belong to the other region; only the first rejection is probed. A rejected
+	// request was not applied, so this is safe for any method.
+	c.regionMu.Lock()
+	if current := c.BaseURL; current != baseURL {
+		// Another request switched regions while this one was in flight against the old one
+		c.regionMu.Unlock()
+		return c.doFrom(current, req, decode)
+	}
+	defer c.regionMu.Unlock()
+	if c.regionChecked {
+		return err
+	}
+	c.regionChecked = true
+	other := otherRegion(baseURL)
+	if other == "" {
+		return err
+	}
+	if otherErr := c.doFrom(other, req, decode); otherErr != nil {
+		return err
+	}
+	log.Printf("API key rejected by %s but accepted by %s; using that region for this run", baseURL, other)
+	c.BaseURL = other
+	return nil
+}
+
+// otherRegion returns the base URL of the other OpsGenie region, or "" for a custom base URL
+func otherRegion(baseURL string) string {
+	switch baseURL {
+	case DefaultBaseURL:
+		return EUBaseURL
+	case EUBaseURL:
+		return DefaultBaseURL
+	default:
+		return ""
+	}
+}
+
+// context returns Context, or a context that is never done when it is not set
+func (c *Client) context() context.Context {
+	if c.Context == nil {
+		return context.Background()
+	}
+	return c.Context
+}
+
+// doFrom performs a single logical request against baseURL, see do
+func (c *Client) doFrom(baseURL string, req request, decode func(body []byte) error) error {
+	url := baseURL + req.path
+	ctx := c.context()
+
+	retries := 0
+	backoff := c.InitialBackoff
+	finalStatus := "error"
+	defer func() {
+		if retries > 0 {
+			c.logRetry(url, retries+1, finalStatus)
+		}
+	}()
+
+	for {
+		if err := c.waitForPause(ctx); err != nil {
+			return err
+		}
+		httpReq, err := http.NewRequestWithContext(ctx, req.method, url, bytes.NewReader(req.body))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		for name, values := range req.header {
+			httpReq.Header[name] = values
+		}
+		httpReq.Header.Set("Authorization", "GenieKey "+c.APIKey)
+		httpReq.Header.Set("Content-Type", "application/json")
+		probe, err := c.breaker.allow(c.BreakerThreshold)
+		if err != nil {
+			return err
+		}
+
+		if err := c.limiter.acquire(ctx, c.AdaptiveConcurrency); err != nil {
+			c.breaker.release(probe)
+			return &Error{Kind: KindNetwork, Err: fmt.Errorf("request cancelled: %w", err)}
+		}
+		resp, err := c.HTTPClient.Do(httpReq)
+		if err != nil {
+			c.limiter.release(c.AdaptiveConcurrency, 0)
+			if ctx.Err() != nil {
+				// Our own deadline, not a sign the API is down
+				c.breaker.release(probe)
+				return &Error{Kind: KindNetwork, Err: fmt.Errorf("request cancelled: %w", ctx.Err())}
+			}
+			c.breaker.record(false, c.BreakerThreshold, c.BreakerCooldown)
+			return &Error{Kind: KindNetwork, Err: fmt.Errorf("request failed: %w", err)}
+		}
+		c.limiter.release(c.AdaptiveConcurrency, resp.StatusCode)
+		finalStatus = fmt.Sprint(resp.StatusCode)
+		c.recordRateLimit(resp)
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			c.breaker.record(true, c.BreakerThreshold, c.BreakerCooldown)
+			buf := bodyBuffers.Get().(*bytes.Buffer)
+			buf.Reset()
+			if resp.ContentLength > 0 {
+				buf.Grow(int(resp.ContentLength))
+			}
+			_, err := buf.ReadFrom(resp.Body)
+			resp.Body.Close()
+			if err == nil {
+				if c.DumpDir != "" && req.method == http.MethodGet {
+					c.dump(req.path, buf.Bytes())
+				}
+				err = decode(buf.Bytes())
+			} else {
+				err = &Error{Kind: KindNetwork, Err: fmt.Errorf("failed to read response: %w", err)}
+			}
+			bodyBuffers.Put(buf)
+			return err
+		}
+
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		resp.Body.Close()
+		if err != nil {
+			c.breaker.record(false, c.BreakerThreshold, c.BreakerCooldown)
+			return &Error{Kind: KindNetwork, Err: fmt.Errorf("failed to read response: %w", err)}
+		}
+		// Any response short of a server error shows the API is up
+		c.breaker.record(resp.StatusCode < 500, c.BreakerThreshold, c.BreakerCooldown)
+
+		// Handle rate limiting
+		if resp.StatusCode == http.StatusTooManyRequests {
+			if !req.retryable() {
+				return &Error{Kind: KindNetwork, Err: fmt.Errorf("rate limited; not retrying %s without an %s header", req.method, IdempotencyKeyHeader)}
+			}
+			if retries >= c.MaxRetries {
+				return &Error{Kind: KindNetwork, Err: errors.New("exceeded maximum retries due to rate limiting")}
+			}
+			wait := retryAfter(resp, jitter(backoff))
+			log.Printf("Rate limited. Retrying in %v...", wait)
+			retries++
+			c.pauseRequests(wait)
+			backoff *= 2
+			continue
+		}
+
+		if resp.StatusCode == http.StatusNotFound {
+			return &Error{Kind: KindGeneric, Err: ErrNotFound}
+		}
+		return &Error{
+			Kind: statusErrorKind(resp.StatusCode),
+			Err:  fmt.Errorf("API response status: %s, body: %s", resp.Status, string(body)),
+		}
+	}
+}
+
+func (c *Client) recordRateLimit(resp *http.Response) {
+	if state := resp.Header.Get("X-RateLimit-State"); state != "" {
+		c.rateLimitMu.Lock()
+		c.rateLimitState = state
+		c.rateLimitMu.Unlock()
+	}
+
+	remaining, err := strconv.Atoi(resp.Header.Get("X-RateLimit-Remaining"))
+	if err == nil && remaining < c.RateLimitWarnBelow {
+		log.Printf("Warning: only %d requests left in the API rate limit", remaining)
+	}
+	if c.RateLimitLog == nil {
+		return
+	}
+	var headers []string
+	for name, values := range resp.Header {
+		if strings.HasPrefix(name, "X-Ratelimit-") && len(values) > 0 {
+			headers = append(headers, strings.TrimPrefix(name, "X-Ratelimit-")+"="+values[0])
+		}
+	}
+	if len(headers) == 0 {
+		return
+	}
+	sort.Strings(headers)
+	c.rateLimitMu.Lock()
+	defer c.rateLimitMu.Unlock()
+	fmt.Fprintf(c.RateLimitLog, "%s\t%s\t%s\n", time.Now().UTC().Format(time.RFC3339), resp.Request.URL, strings.Join(headers, " "))
+}
+
+// RateLimitState returns the X-RateLimit-State header OpsGenie sent with the latest response
+// that had one: "OK", or "THROTTLED" once the account's rate limit is hit. It is empty
+// before any such response.
+func (c *Client) RateLimitState() string {
+	c.rateLimitMu.Lock()
+	defer c.rateLimitMu.Unlock()
+	return c.rateLimitState
+}
+
+// waitForPause blocks while requests are paused after a rate limit response, failing early
+// when ctx is done
+func (c *Client) waitForPause(ctx context.Context) error {
+	c.pauseMu.Lock()
+	until := c.pausedUntil
+	c.pauseMu.Unlock()
+	wait := time.Until(until)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return &Error{Kind: KindNetwork, Err: fmt.Errorf("request cancelled: %w", ctx.Err())}
+	}
+}
+
+// pauseRequests holds back new requests for at least d from now
+func (c *Client) pauseRequests(d time.Duration) {
+	until := time.Now().Add(d)
+	c.pauseMu.Lock()
+	if until.After(c.pausedUntil) {
+		c.pausedUntil = until
+	}
+	c.pauseMu.Unlock()
+}
+
+// retryAfter returns the wait requested by a response's Retry-After header (seconds or an
+// HTTP date), or fallback when it is missing or invalid
+func retryAfter(resp *http.Response, fallback time.Duration) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return fallback
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+	return fallback
+}
+
+// jitter returns a random duration in [d/2, d]
+func jitter(d time.Duration) time.Duration {
+	if d <= 1 {
+		return d
+	}
+	return d/2 + rand.N(d-d/2+1)
+}
+
+func (c *Client) logRetry(url string, attempts int, finalStatus string) {
+	if c.RetryLog == nil {
+		return
+	}
+	c.retryLogMu.Lock()
+	defer c.retryLogMu.Unlock()
+	fmt.Fprintf(c.RetryLog, "%s\t%s\t%d\t%s\n", time.Now().UTC().Format(time.RFC3339), url, attempts, finalStatus)
+}
+
+// getJSON performs a GET request and decodes the response body into v
+func (c *Client) getJSON(path string, v any) error {
+	return c.get(path, decodeJSON(v))
+}
+
+// PostJSON POSTs in as JSON to path (relative to the API base URL) and decodes the response
+// body into out unless it is nil. A rate-limited POST is only retried when idempotencyKey is
+// set; it is sent as the IdempotencyKeyHeader so the API applies the request once.
+func (c *Client) PostJSON(path string, in, out any, idempotencyKey string) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return &Error{Kind: KindValidation, Err: fmt.Errorf("failed to encode request: %w", err)}
+	}
+	req := request{method: http.MethodPost, path: path, body: body, header: make(http.Header)}
+	if idempotencyKey != "" {
+		req.header.Set(IdempotencyKeyHeader, idempotencyKey)
+	}
+	if out == nil {
+		return c.do(req, func([]byte) error { return nil })
+	}
+	return c.do(req, decodeJSON(out))
+}
+
+// decodeJSON returns a decode function for do that unmarshals the body into v
+func decodeJSON(v any) func(body []byte) error {
+	return func(body []byte) error {
+		if err := json.Unmarshal(body, v); err != nil {
+			return &Error{Kind: KindParse, Err: fmt.Errorf("failed to parse response: %w", err)}
+		}
+		return nil
+	}
+}
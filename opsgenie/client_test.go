@@ -0,0 +1,179 @@
+package opsgenie
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// staticTransport answers every request with the same 200 response body, without a network
+// round trip, so benchmarks measure only the client's own reading and decoding
+type staticTransport struct {
+	body []byte
+}
+
+func (s staticTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Status:        "200 OK",
+		Header:        make(http.Header),
+		Body:          io.NopCloser(bytes.NewReader(s.body)),
+		ContentLength: int64(len(s.body)),
+		Request:       req,
+	}, nil
+}
+
+// roundTripFunc answers requests with a function, for scripting responses in tests
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func jsonResponse(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Status:     http.StatusText(status),
+		Header:     make(http.Header),
+		Body:       io.NopCloser(bytes.NewReader([]byte(body))),
+		Request:    req,
+	}
+}
+
+func TestBreakerReleasesCancelledProbe(t *testing.T) {
+	status := http.StatusInternalServerError
+	client := NewClient("test-key")
+	client.DetectRegion = false
+	client.BreakerThreshold = 1
+	client.BreakerCooldown = 0
+	client.HTTPClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+		return jsonResponse(req, status, `{}`), nil
+	})}
+	var v struct{}
+
+	// One server error opens the circuit
+	if err := client.getJSON("/schedules", &v); err == nil {
+		t.Fatal("expected the server error to be returned")
+	}
+	// The half-open probe is cancelled by our own deadline
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client.Context = ctx
+	if err := client.getJSON("/schedules", &v); errors.Is(err, ErrCircuitOpen) || err == nil {
+		t.Fatalf("probe: got %v, want a cancellation error", err)
+	}
+	// The next request may probe again and closes the circuit
+	client.Context = nil
+	status = http.StatusOK
+	if err := client.getJSON("/schedules", &v); err != nil {
+		t.Fatalf("after a cancelled probe: %v", err)
+	}
+	if err := client.getJSON("/schedules", &v); err != nil {
+		t.Fatalf("after the circuit closed: %v", err)
+	}
+}
+
+func TestRegionDetectionRetriesConcurrentRejections(t *testing.T) {
+	const requests = 5
+	var arrived sync.WaitGroup
+	arrived.Add(requests)
+	client := NewClient("eu-key")
+	client.HTTPClient = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Host == "api.eu.opsgenie.com" {
+			return jsonResponse(req, http.StatusOK, `{"data":[]}`), nil
+		}
+		// Every request is rejected by the US region before any of them probes the EU one
+		arrived.Done()
+		arrived.Wait()
+		return jsonResponse(req, http.StatusUnauthorized, `{"message":"Key format is not valid!"}`), nil
+	})}
+
+	errs := make(chan error, requests)
+	for i := 0; i < requests; i++ {
+		go func() {
+			_, _, err := client.ListSchedules()
+			errs <- err
+		}()
+	}
+	for i := 0; i < requests; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("request %d: %v", i, err)
+		}
+	}
+	if client.BaseURL != EUBaseURL {
+		t.Errorf("BaseURL = %s, want %s", client.BaseURL, EUBaseURL)
+	}
+}
+
+// benchmarkTimeline returns a timeline response body for one week from start with rotations
+// rotations of hourly periods, about the size of a busy schedule's chunk
+func benchmarkTimeline(b *testing.B, start time.Time, rotations int) []byte {
+	b.Helper()
+	var resp TimelineResponse
+	for r := 0; r < rotations; r++ {
+		rotation := TimelineRotation{ID: fmt.Sprintf("r%d", r), Name: fmt.Sprintf("Rotation %d", r)}
+		for h := 0; h < 7*24; h++ {
+			periodStart := start.Add(time.Duration(h) * time.Hour)
+			rotation.Periods = append(rotation.Periods, RotationPeriod{
+				StartDate: periodStart.Format(time.RFC3339),
+				EndDate:   periodStart.Add(time.Hour).Format(time.RFC3339),
+				Type:      "historical",
+				Recipient: Recipient{ID: fmt.Sprintf("u%d", h%5), Name: fmt.Sprintf("user%d@example.com", h%5), Type: "user"},
+			})
+		}
+		resp.Data.FinalTimeline.Rotations = append(resp.Data.FinalTimeline.Rotations, rotation)
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return body
+}
+
+func newStaticClient(body []byte) *Client {
+	client := NewClient("test-key")
+	client.DetectRegion = false
+	client.HTTPClient = &http.Client{Transport: staticTransport{body}}
+	return client
+}
+
+// BenchmarkDecodeTimeline measures fetching and decoding one timeline chunk through the
+// pooled response buffers: go test -bench DecodeTimeline -benchmem ./opsgenie
+func BenchmarkDecodeTimeline(b *testing.B) {
+	start := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	body := benchmarkTimeline(b, start, 4)
+	client := newStaticClient(body)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Timeline("s1", start, 7, "days"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReport measures an exact report over four weekly chunks, including the hour by
+// hour crediting of periods: go test -bench Report -benchmem ./opsgenie
+func BenchmarkReport(b *testing.B) {
+	start := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	client := newStaticClient(benchmarkTimeline(b, start, 2))
+	end := start.AddDate(0, 0, 28)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := client.Report("s1", start, end, ReportOptions{Exact: true, ClipToRange: true}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
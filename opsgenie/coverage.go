@@ -0,0 +1,50 @@
+package opsgenie
+
+import "time"
+
+// CoverageViolation is a stretch of a schedule not covered by exactly one person: a gap
+// when People is empty, an overlap otherwise
+type CoverageViolation struct {
+	Start  time.Time
+	End    time.Time
+	People []string // sorted
+}
+
+// Gap reports whether no one was on call during the violation
+func (v CoverageViolation) Gap() bool {
+	return len(v.People) == 0
+}
+
+// CoverageViolations checks from the final timeline that exactly one person is on call at
+// every moment of [start, end), and returns the stretches where that does not hold in
+// chronological order. A non-empty rotation limits the check to that rotation, as in
+// ReportOptions.Rotation.
+func (c *Client) CoverageViolations(scheduleID string, start, end time.Time, rotation string) ([]CoverageViolation, error) {
+	periods, err := c.timelinePeriods(scheduleID, start, end, rotation)
+	if err != nil {
+		return nil, err
+	}
+
+	edges := append([]time.Time{start}, periodBoundaries(periods, start, end)...)
+	edges = append(edges, end)
+	var violations []CoverageViolation
+	for i := 0; i+1 < len(edges); i++ {
+		from, to := edges[i], edges[i+1]
+		var onCall []string
+		for _, p := range periods {
+			if !p.start.After(from) && p.end.After(from) {
+				onCall = append(onCall, p.name)
+			}
+		}
+		onCall = uniqueSorted(onCall)
+		if len(onCall) == 1 {
+			continue
+		}
+		if n := len(violations); n > 0 && violations[n-1].End.Equal(from) && equalStrings(violations[n-1].People, onCall) {
+			violations[n-1].End = to
+			continue
+		}
+		violations = append(violations, CoverageViolation{Start: from, End: to, People: onCall})
+	}
+	return violations, nil
+}
@@ -0,0 +1,127 @@
+package opsgenie
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // Europe/London without relying on the system zone database
+)
+
+func london(t *testing.T) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestDSTTransitionsEuropeLondon(t *testing.T) {
+	loc := london(t)
+	tests := []struct {
+		name       string
+		start, end time.Time
+		want       map[string]float64 // day -> hours of each transition
+	}{
+		{"spring forward", time.Date(2025, 3, 29, 0, 0, 0, 0, loc), time.Date(2025, 4, 1, 0, 0, 0, 0, loc), map[string]float64{"2025-03-30": 23}},
+		{"fall back", time.Date(2025, 10, 25, 0, 0, 0, 0, loc), time.Date(2025, 10, 28, 0, 0, 0, 0, loc), map[string]float64{"2025-10-26": 25}},
+		{"whole year", time.Date(2025, 1, 1, 0, 0, 0, 0, loc), time.Date(2026, 1, 1, 0, 0, 0, 0, loc), map[string]float64{"2025-03-30": 23, "2025-10-26": 25}},
+		{"no transition", time.Date(2025, 6, 1, 0, 0, 0, 0, loc), time.Date(2025, 7, 1, 0, 0, 0, 0, loc), map[string]float64{}},
+		// A range starting late on the transition day still includes that day
+		{"starts during the day", time.Date(2025, 3, 30, 20, 0, 0, 0, time.UTC), time.Date(2025, 3, 31, 6, 0, 0, 0, time.UTC), map[string]float64{"2025-03-30": 23}},
+		{"ends at its midnight", time.Date(2025, 3, 29, 0, 0, 0, 0, loc), time.Date(2025, 3, 30, 0, 0, 0, 0, loc), map[string]float64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DSTTransitions(tt.start, tt.end, loc)
+			if len(got) != len(tt.want) {
+				t.Fatalf("DSTTransitions() = %v, want %v", got, tt.want)
+			}
+			for _, transition := range got {
+				day := transition.Day.Format("2006-01-02")
+				if hours, ok := tt.want[day]; !ok || transition.Length.Hours() != hours {
+					t.Errorf("transition %s of %v hours, want %v", day, transition.Length.Hours(), tt.want)
+				}
+				if transition.Day.Hour() != 0 || transition.Day.Location() != loc {
+					t.Errorf("transition day %v does not start at local midnight", transition.Day)
+				}
+			}
+		})
+	}
+	if got := DSTTransitions(time.Date(2025, 3, 29, 0, 0, 0, 0, time.UTC), time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), nil); len(got) != 0 {
+		t.Errorf("DSTTransitions() in UTC = %v, want none", got)
+	}
+}
+
+func TestLocalDayAcrossDST(t *testing.T) {
+	loc := london(t)
+	tests := []struct {
+		name        string
+		at          time.Time
+		wantDay     time.Time // UTC instant of the local midnight
+		wantNextDay time.Time
+	}{
+		// 01:00 GMT becomes 02:00 BST on 30 March 2025
+		{"before spring forward", time.Date(2025, 3, 30, 0, 30, 0, 0, time.UTC), time.Date(2025, 3, 30, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 30, 23, 0, 0, 0, time.UTC)},
+		{"after spring forward", time.Date(2025, 3, 30, 22, 59, 0, 0, time.UTC), time.Date(2025, 3, 30, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 30, 23, 0, 0, 0, time.UTC)},
+		{"day after spring forward", time.Date(2025, 3, 30, 23, 0, 0, 0, time.UTC), time.Date(2025, 3, 30, 23, 0, 0, 0, time.UTC), time.Date(2025, 3, 31, 23, 0, 0, 0, time.UTC)},
+		// 02:00 BST becomes 01:00 GMT on 26 October 2025; 01:30 local happens twice
+		{"first 01:30 of fall back", time.Date(2025, 10, 26, 0, 30, 0, 0, time.UTC), time.Date(2025, 10, 25, 23, 0, 0, 0, time.UTC), time.Date(2025, 10, 27, 0, 0, 0, 0, time.UTC)},
+		{"second 01:30 of fall back", time.Date(2025, 10, 26, 1, 30, 0, 0, time.UTC), time.Date(2025, 10, 25, 23, 0, 0, 0, time.UTC), time.Date(2025, 10, 27, 0, 0, 0, 0, time.UTC)},
+		{"end of fall back day", time.Date(2025, 10, 26, 23, 59, 0, 0, time.UTC), time.Date(2025, 10, 25, 23, 0, 0, 0, time.UTC), time.Date(2025, 10, 27, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			day := localDay(tt.at, loc)
+			if !day.Equal(tt.wantDay) {
+				t.Errorf("localDay() = %v, want %v", day.UTC(), tt.wantDay)
+			}
+			if next := nextDay(day); !next.Equal(tt.wantNextDay) {
+				t.Errorf("nextDay() = %v, want %v", next.UTC(), tt.wantNextDay)
+			}
+		})
+	}
+}
+
+func TestAddPeriodAcrossDST(t *testing.T) {
+	loc := london(t)
+	opts := ReportOptions{BusinessHours: BusinessHours{Start: 9, End: 17, Location: loc}}
+	tests := []struct {
+		name       string
+		start, end time.Time
+		want       map[string]float64 // local day -> hours credited to it
+		wantTotal  float64
+		wantOffHrs float64
+	}{
+		{"spring forward day", time.Date(2025, 3, 30, 0, 0, 0, 0, loc), time.Date(2025, 3, 31, 0, 0, 0, 0, loc),
+			map[string]float64{"2025-03-30": 23}, 23, 23},
+		{"fall back day", time.Date(2025, 10, 26, 0, 0, 0, 0, loc), time.Date(2025, 10, 27, 0, 0, 0, 0, loc),
+			map[string]float64{"2025-10-26": 25}, 25, 25},
+		// Friday 18:00 to Monday 10:00 local: one business hour on Monday
+		{"weekend around spring forward", time.Date(2025, 3, 28, 18, 0, 0, 0, loc), time.Date(2025, 3, 31, 10, 0, 0, 0, loc),
+			map[string]float64{"2025-03-28": 6, "2025-03-29": 24, "2025-03-30": 23, "2025-03-31": 10}, 63, 62},
+		{"night across fall back", time.Date(2025, 10, 25, 22, 0, 0, 0, loc), time.Date(2025, 10, 26, 6, 0, 0, 0, loc),
+			map[string]float64{"2025-10-25": 2, "2025-10-26": 7}, 9, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &Report{People: make(map[string]*PersonData)}
+			report.addPeriod("alice", tt.start, tt.end, opts)
+			pdata := report.People["alice"]
+			if !approxEqual(pdata.TotalHours, tt.wantTotal) || !approxEqual(pdata.OffHours, tt.wantOffHrs) {
+				t.Errorf("total %v, off-hours %v; want %v, %v", pdata.TotalHours, pdata.OffHours, tt.wantTotal, tt.wantOffHrs)
+			}
+			if len(pdata.DailyHours) != len(tt.want) {
+				t.Errorf("daily hours = %v, want %v", pdata.DailyHours, tt.want)
+			}
+			for day, hours := range pdata.DailyHours {
+				local := day.In(loc)
+				if local.Hour() != 0 {
+					t.Errorf("day %v is not a local midnight", local)
+				}
+				if want := tt.want[local.Format("2006-01-02")]; !approxEqual(hours, want) {
+					t.Errorf("%s: %v hours, want %v", local.Format("2006-01-02"), hours, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package opsgenie
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrorKind classifies failures so callers can react to them consistently
+type ErrorKind int
+
+const (
+	KindGeneric ErrorKind = iota
+	KindValidation
+	KindAuth
+	KindNetwork
+	KindParse
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindValidation:
+		return "validation"
+	case KindAuth:
+		return "auth"
+	case KindNetwork:
+		return "network"
+	case KindParse:
+		return "parse"
+	default:
+		return "error"
+	}
+}
+
+// ErrNoCurrentShift is returned by ShiftEnd when the timeline has no period covering the
+// queried instant, i.e. there is a gap in coverage rather than a failed lookup
+var ErrNoCurrentShift = errors.New("no current on-call shift")
+
+// ErrCircuitOpen is returned without contacting the API while the client's circuit breaker
+// is open after repeated consecutive failures
+var ErrCircuitOpen = errors.New("OpsGenie API appears down")
+
+// ErrNotFound is returned when the API answers 404, e.g. for a schedule deleted after the
+// schedule list was fetched. The response body is left out since it only restates that.
+var ErrNotFound = errors.New("not found (HTTP 404)")
+
+// Error wraps an underlying error with its kind
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the kind of the first *Error in err's chain
+func KindOf(err error) ErrorKind {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Kind
+	}
+	return KindGeneric
+}
+
+// statusErrorKind maps a non-200 API status code to an error kind
+func statusErrorKind(statusCode int) ErrorKind {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return KindAuth
+	case statusCode >= 500:
+		return KindNetwork
+	default:
+		return KindGeneric
+	}
+}
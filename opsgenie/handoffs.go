@@ -0,0 +1,139 @@
+package opsgenie
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Handoff is a moment the set of people on call for a schedule changes
+type Handoff struct {
+	At   time.Time
+	From []string // on call until At, sorted; empty after a gap in coverage
+	To   []string // on call from At, sorted; empty when a gap starts
+}
+
+// Handoffs returns every change of who is on call for a schedule within (start, end),
+// in chronological order, built from the final timeline fetched in 7-day chunks. A
+// non-empty rotation limits it to that rotation, as in ReportOptions.Rotation.
+func (c *Client) Handoffs(scheduleID string, start, end time.Time, rotation string) ([]Handoff, error) {
+	periods, err := c.timelinePeriods(scheduleID, start, end, rotation)
+	if err != nil {
+		return nil, err
+	}
+
+	var handoffs []Handoff
+	for _, at := range periodBoundaries(periods, start, end) {
+		var before, after []string
+		for _, p := range periods {
+			if p.start.Before(at) && !p.end.Before(at) {
+				before = append(before, p.name)
+			}
+			if !p.start.After(at) && p.end.After(at) {
+				after = append(after, p.name)
+			}
+		}
+		before, after = uniqueSorted(before), uniqueSorted(after)
+		if !equalStrings(before, after) {
+			handoffs = append(handoffs, Handoff{At: at, From: before, To: after})
+		}
+	}
+	return handoffs, nil
+}
+
+// timelinePeriod is one recipient's on-call period from a schedule timeline
+type timelinePeriod struct {
+	name       string
+	start, end time.Time
+}
+
+// timelinePeriods fetches the final timeline of [start, end) in 7-day chunks and returns its
+// distinct named periods, limited to one rotation when rotation is not empty
+func (c *Client) timelinePeriods(scheduleID string, start, end time.Time, rotation string) ([]timelinePeriod, error) {
+	// Periods crossing a chunk boundary are returned with both chunks
+	seen := make(map[timelinePeriod]bool)
+	var periods []timelinePeriod
+	rotationFound := rotation == ""
+	for chunkStart := start; chunkStart.Before(end); chunkStart = chunkStart.AddDate(0, 0, timelineChunkDays) {
+		chunkEnd := chunkStart.AddDate(0, 0, timelineChunkDays)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+		days := int(math.Ceil(chunkEnd.Sub(chunkStart).Hours() / 24))
+
+		timeline, err := c.Timeline(scheduleID, chunkStart, days, "days")
+		if err != nil {
+			return nil, err
+		}
+		for i, timelineRotation := range timeline.Rotations {
+			if rotation != "" {
+				if !MatchesRotation(timelineRotation, i, rotation) {
+					continue
+				}
+				rotationFound = true
+			}
+			for _, rotationPeriod := range timelineRotation.Periods {
+				if rotationPeriod.Recipient.Name == "" {
+					continue
+				}
+				periodStart, err1 := time.Parse(time.RFC3339, rotationPeriod.StartDate)
+				periodEnd, err2 := time.Parse(time.RFC3339, rotationPeriod.EndDate)
+				if err1 != nil || err2 != nil || !periodEnd.After(periodStart) {
+					continue
+				}
+				p := timelinePeriod{rotationPeriod.Recipient.Name, periodStart.UTC(), periodEnd.UTC()}
+				if !seen[p] {
+					seen[p] = true
+					periods = append(periods, p)
+				}
+			}
+		}
+	}
+	if !rotationFound {
+		return nil, &Error{Kind: KindValidation, Err: fmt.Errorf("rotation %q not found in schedule %s", rotation, scheduleID)}
+	}
+	return periods, nil
+}
+
+// periodBoundaries returns the sorted instants strictly inside (start, end) where a period
+// starts or ends: the only places who is on call can change
+func periodBoundaries(periods []timelinePeriod, start, end time.Time) []time.Time {
+	boundarySet := make(map[time.Time]bool)
+	for _, p := range periods {
+		for _, t := range []time.Time{p.start, p.end} {
+			if t.After(start) && t.Before(end) {
+				boundarySet[t] = true
+			}
+		}
+	}
+	boundaries := make([]time.Time, 0, len(boundarySet))
+	for t := range boundarySet {
+		boundaries = append(boundaries, t)
+	}
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i].Before(boundaries[j]) })
+	return boundaries
+}
+
+func uniqueSorted(values []string) []string {
+	sort.Strings(values)
+	unique := values[:0]
+	for i, value := range values {
+		if i == 0 || value != values[i-1] {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package opsgenie
+
+import (
+	"context"
+	"sync"
+)
+
+// adaptiveLimiter caps the number of requests in flight with an AIMD limit: it starts at
+// one, grows by one after a full limit's worth of consecutive successful responses, and
+// halves on every rate-limit response
+type adaptiveLimiter struct {
+	mu sync.Mutex
+	// freed is closed, and replaced, whenever a request ends, waking every waiting acquire
+	freed     chan struct{}
+	limit     int
+	inFlight  int
+	successes int
+}
+
+// acquire blocks until a request may be sent or ctx is done, returning ctx's error in that
+// case; maxLimit <= 0 disables the limiter
+func (l *adaptiveLimiter) acquire(ctx context.Context, maxLimit int) error {
+	if maxLimit <= 0 {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		if l.freed == nil {
+			l.freed = make(chan struct{})
+			l.limit = 1
+		}
+		if l.inFlight < l.limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		freed := l.freed
+		l.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release ends a request let through by acquire, adjusting the limit by its HTTP status
+// (0 for a network error, which leaves the limit unchanged)
+func (l *adaptiveLimiter) release(maxLimit, status int) {
+	if maxLimit <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	switch {
+	case status == 429:
+		l.limit = max(1, l.limit/2)
+		l.successes = 0
+	case status >= 200 && status < 300:
+		l.successes++
+		if l.successes >= l.limit && l.limit < maxLimit {
+			l.limit++
+			l.successes = 0
+		}
+	}
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
@@ -0,0 +1,38 @@
+package opsgenie
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiterAcquireHonorsContext(t *testing.T) {
+	var l adaptiveLimiter
+	if err := l.acquire(context.Background(), 4); err != nil {
+		t.Fatal(err)
+	}
+
+	// The limit starts at one, so a second request waits until its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx, 4); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acquire past the limit = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// A waiter is woken by the release of the request ahead of it
+	acquired := make(chan error, 1)
+	go func() { acquired <- l.acquire(context.Background(), 4) }()
+	l.release(4, 200)
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter not woken by release")
+	}
+	if l.inFlight != 1 {
+		t.Errorf("in flight = %d, want 1", l.inFlight)
+	}
+}
@@ -0,0 +1,75 @@
+package opsgenie
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dumpExt is the extension of response files written to DumpDir
+const dumpExt = ".json"
+
+// Replay answers requests from response bodies saved with DumpDir instead of the network,
+// for reproducing parsing and rendering offline
+type Replay struct {
+	responses map[string][]byte // request path with query -> body
+	byPath    map[string][]byte // request path without query -> last body saved for it
+}
+
+// LoadReplay reads the responses saved by DumpDir from path: either one response file or a
+// whole dump directory
+func LoadReplay(path string) (*Replay, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, &Error{Kind: KindValidation, Err: fmt.Errorf("cannot read saved responses: %w", err)}
+	}
+	files := []string{path}
+	if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*"+dumpExt)); err != nil {
+			return nil, &Error{Kind: KindValidation, Err: err}
+		}
+		if len(files) == 0 {
+			return nil, &Error{Kind: KindValidation, Err: fmt.Errorf("no saved responses in %s", path)}
+		}
+	}
+
+	replay := &Replay{responses: make(map[string][]byte), byPath: make(map[string][]byte)}
+	for _, file := range files {
+		requestPath, err := url.QueryUnescape(strings.TrimSuffix(filepath.Base(file), dumpExt))
+		if err != nil || !strings.HasPrefix(requestPath, "/") {
+			return nil, &Error{Kind: KindValidation, Err: fmt.Errorf("%s is not a response saved with -dump-dir (its name must be the escaped request path)", file)}
+		}
+		body, err := os.ReadFile(file)
+		if err != nil {
+			return nil, &Error{Kind: KindValidation, Err: fmt.Errorf("cannot read saved responses: %w", err)}
+		}
+		replay.responses[requestPath] = body
+		withoutQuery, _, _ := strings.Cut(requestPath, "?")
+		replay.byPath[withoutQuery] = body
+	}
+	return replay, nil
+}
+
+// response returns the body saved for path. Without an exact match it falls back to a body
+// saved for the same path with another query, so a dump taken at another time (e.g. the
+// on-calls of a schedule at a different date) still answers.
+func (r *Replay) response(path string) ([]byte, bool) {
+	if body, ok := r.responses[path]; ok {
+		return body, true
+	}
+	withoutQuery, _, _ := strings.Cut(path, "?")
+	body, ok := r.byPath[withoutQuery]
+	return body, ok
+}
+
+// dump saves the body of a successful response to DumpDir, named after the escaped request
+// path. Failures are logged, not returned, so they never fail the command.
+func (c *Client) dump(path string, body []byte) {
+	file := filepath.Join(c.DumpDir, url.QueryEscape(path)+dumpExt)
+	if err := os.WriteFile(file, body, 0o644); err != nil {
+		log.Printf("Warning: cannot save response for %s: %v", path, err)
+	}
+}
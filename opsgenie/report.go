@@ -0,0 +1,783 @@
+package opsgenie
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timeline requests are split into chunks of this many days
+const timelineChunkDays = 7
+
+// Report holds the on-call hours per person for a schedule over [Start, End)
+type Report struct {
+	ScheduleID string
+	Start      time.Time
+	End        time.Time
+	Location   *time.Location // zone of the business hours, which DailyHours days follow
+	People     map[string]*PersonData
+	// CoveredHours is how much of [Start, End) had at least one recipient on call
+	CoveredHours float64
+	// WeekdaysOnly is set when weekend hours were left out, see ReportOptions.WeekdaysOnly
+	WeekdaysOnly bool
+	// Overlaps are the stretches, in time order, during which more than
+	// ReportOptions.MaxConcurrent people were on call at once
+	Overlaps []Overlap
+	// ExcludedHours are the hours of recipients dropped by ReportOptions.Exclude, by name
+	ExcludedHours map[string]float64
+	// Segments are the non-contiguous ranges a report built by JoinReports covers, in time
+	// order; nil means the whole of [Start, End)
+	Segments []Range
+}
+
+// Range is a stretch of time [Start, End)
+type Range struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Overlap is a stretch of a schedule during which the same set of more people than expected
+// was on call, hinting at a misconfigured rotation or a forgotten override
+type Overlap struct {
+	ScheduleID string
+	Start      time.Time
+	End        time.Time
+	People     []string // sorted
+}
+
+// OverlapHours sums the duration of the report's Overlaps
+func (r *Report) OverlapHours() float64 {
+	var total float64
+	for _, overlap := range r.Overlaps {
+		total += overlap.End.Sub(overlap.Start).Hours()
+	}
+	return total
+}
+
+// ReportOptions controls how Report aggregates hours
+type ReportOptions struct {
+	// Exact computes fractional hours from timeline periods instead of sampling once per hour
+	Exact bool
+	// ClipToRange only counts the part of timeline periods inside the range (Exact only)
+	ClipToRange bool
+	// Rotation limits the report to one rotation, matched by ID, case-insensitive name or
+	// 1-based position in the timeline (Exact only)
+	Rotation string
+	// Identities maps lower-cased recipient aliases to the canonical name their hours are
+	// credited to, so one person appearing under several names is counted once
+	Identities map[string]string
+	// Exclude, if set, drops the recipients whose canonical name it matches from the report,
+	// such as bot or relay accounts: their hours are not credited and they count towards
+	// neither coverage nor overlaps, only towards Report.ExcludedHours
+	Exclude func(name string) bool
+	// BusinessHours classifies each on-call hour as business or off-hours; the zero value
+	// means DefaultBusinessHours
+	BusinessHours BusinessHours
+	// MaxConcurrent is how many people are expected on call at once; stretches with more are
+	// recorded as Report.Overlaps. Zero means 1.
+	MaxConcurrent int
+	// WeekdaysOnly leaves out Saturdays and Sundays in the business hours' Location, both
+	// from the people's hours and from the range Coverage is measured against
+	WeekdaysOnly bool
+	// RequestInterval is the pause between hourly samples (not Exact); zero means none
+	RequestInterval time.Duration
+	// Progress, if set, is called after each processed hour (or timeline chunk)
+	Progress func(processed time.Time)
+	// OnCheckpoint, if set, is called after each processed hour (or timeline chunk) with
+	// the state needed to resume the report from there
+	OnCheckpoint func(Checkpoint)
+	// Resume continues a report from a checkpoint taken with the same schedule, range and
+	// options instead of starting over
+	Resume *Checkpoint
+}
+
+// Checkpoint is the partial state of a report: the hours counted so far and the first
+// instant not yet processed. People is a copy, safe to keep while the report continues.
+type Checkpoint struct {
+	ScheduleID string
+	Start      time.Time
+	End        time.Time
+	Exact      bool
+	// WeekdaysOnly is ReportOptions.WeekdaysOnly of the report being checkpointed
+	WeekdaysOnly bool
+	Next         time.Time
+	People       map[string]*PersonData
+	// CoveredHours is Report.CoveredHours up to Next
+	CoveredHours float64
+	// Overlaps is Report.Overlaps up to Next
+	Overlaps []Overlap
+	// ExcludedHours is Report.ExcludedHours up to Next
+	ExcludedHours map[string]float64
+}
+
+// BusinessHours is a weekday (Monday to Friday) window of local hours [Start, End)
+type BusinessHours struct {
+	Start    int
+	End      int
+	Location *time.Location // nil means UTC
+}
+
+// DefaultBusinessHours is 09:00-17:00 UTC on weekdays
+var DefaultBusinessHours = BusinessHours{Start: 9, End: 17}
+
+func (b BusinessHours) location() *time.Location {
+	if b.Location == nil {
+		return time.UTC
+	}
+	return b.Location
+}
+
+// Contains reports whether t falls inside the business hours
+func (b BusinessHours) Contains(t time.Time) bool {
+	local := t.In(b.location())
+	if isWeekend(local) {
+		return false
+	}
+	return local.Hour() >= b.Start && local.Hour() < b.End
+}
+
+func isWeekend(local time.Time) bool {
+	return local.Weekday() == time.Saturday || local.Weekday() == time.Sunday
+}
+
+// countedHours returns how many hours of [start, end) the report counts: all of them, or
+// with WeekdaysOnly just those on weekdays in the business hours' Location
+func (opts ReportOptions) countedHours(start, end time.Time) float64 {
+	if !opts.WeekdaysOnly {
+		return end.Sub(start).Hours()
+	}
+	return weekdayHours(start, end, opts.businessHours().location())
+}
+
+func weekdayHours(start, end time.Time, loc *time.Location) float64 {
+	var total time.Duration
+	for day := localDay(start, loc); day.Before(end); day = nextDay(day) {
+		if isWeekend(day) {
+			continue
+		}
+		from, to := day, nextDay(day)
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		total += to.Sub(from)
+	}
+	return total.Hours()
+}
+
+func (opts ReportOptions) businessHours() BusinessHours {
+	if opts.BusinessHours.End == 0 {
+		return DefaultBusinessHours
+	}
+	return opts.BusinessHours
+}
+
+// ProgressSteps returns how many times Report calls Progress for the range [start, end)
+func (opts ReportOptions) ProgressSteps(start, end time.Time) int {
+	if !end.After(start) {
+		return 0
+	}
+	if opts.Exact {
+		steps := 0
+		for chunkStart := start; chunkStart.Before(end); chunkStart = chunkStart.AddDate(0, 0, timelineChunkDays) {
+			steps++
+		}
+		return steps
+	}
+	return int(math.Ceil(float64(end.Sub(start)) / float64(time.Hour)))
+}
+
+// localDay returns the midnight starting t's calendar day in loc. Days are built with
+// time.Date rather than by adding 24 hours, so the 23- and 25-hour days of DST transitions
+// start and end at local midnight.
+func localDay(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+}
+
+func nextDay(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, day.Location())
+}
+
+// DSTTransition is a day that is not 24 hours long in its zone because daylight saving time
+// starts or ends. Reports count such days correctly, by local midnight, but a 23- or 25-hour
+// day in the daily totals looks like a counting error unless it is pointed out.
+type DSTTransition struct {
+	Day    time.Time // local midnight starting the day
+	Length time.Duration
+}
+
+func (t *DSTTransition) Error() string {
+	return fmt.Sprintf("%s has %g hours in %s (DST transition); its daily hours and business/off-hours split follow local time",
+		t.Day.Format("2006-01-02"), t.Length.Hours(), t.Day.Location())
+}
+
+// DSTTransitions returns the days overlapping [start, end) that are not 24 hours long in loc
+// (UTC when nil), walking the days as Report buckets them
+func DSTTransitions(start, end time.Time, loc *time.Location) []*DSTTransition {
+	if loc == nil {
+		loc = time.UTC
+	}
+	var transitions []*DSTTransition
+	for day := localDay(start, loc); day.Before(end); day = nextDay(day) {
+		if length := nextDay(day).Sub(day); length != 24*time.Hour {
+			transitions = append(transitions, &DSTTransition{Day: day, Length: length})
+		}
+	}
+	return transitions
+}
+
+// Days returns the local midnight of every calendar day in the report's Location that
+// overlaps [Start, End). A person's hours on day are DailyHours[day.UTC()].
+func (r *Report) Days() []time.Time {
+	loc := r.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	var days []time.Time
+	for day := localDay(r.Start, loc); day.Before(r.End); day = nextDay(day) {
+		days = append(days, day)
+	}
+	return days
+}
+
+// RangeHours returns the length of the report range in hours, counting only its weekdays
+// with WeekdaysOnly
+func (r *Report) RangeHours() float64 {
+	if len(r.Segments) == 0 {
+		return rangeHours(r.Start, r.End, r.WeekdaysOnly, r.Location)
+	}
+	var total float64
+	for _, segment := range r.Segments {
+		total += rangeHours(segment.Start, segment.End, r.WeekdaysOnly, r.Location)
+	}
+	return total
+}
+
+func rangeHours(start, end time.Time, weekdaysOnly bool, loc *time.Location) float64 {
+	if !weekdaysOnly {
+		return end.Sub(start).Hours()
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return weekdayHours(start, end, loc)
+}
+
+// Coverage returns the percentage of the report range (only its weekdays with WeekdaysOnly)
+// that had at least one recipient on call
+func (r *Report) Coverage() float64 {
+	rangeHours := r.RangeHours()
+	if rangeHours <= 0 {
+		return 0
+	}
+	return r.CoveredHours / rangeHours * 100
+}
+
+// TotalHours sums the hours of every person in the report
+func (r *Report) TotalHours() float64 {
+	var total float64
+	for _, pdata := range r.People {
+		total += pdata.TotalHours
+	}
+	return total
+}
+
+// Report aggregates on-call hours per person for a schedule over [start, end)
+func (c *Client) Report(scheduleID string, start, end time.Time, opts ReportOptions) (*Report, error) {
+	report := &Report{
+		ScheduleID:    scheduleID,
+		Start:         start,
+		End:           end,
+		Location:      opts.businessHours().location(),
+		People:        make(map[string]*PersonData),
+		WeekdaysOnly:  opts.WeekdaysOnly,
+		ExcludedHours: make(map[string]float64),
+	}
+
+	from := start
+	if resume := opts.Resume; resume != nil {
+		if resume.ScheduleID != scheduleID || !resume.Start.Equal(start) || !resume.End.Equal(end) ||
+			resume.Exact != opts.Exact || resume.WeekdaysOnly != opts.WeekdaysOnly {
+			return nil, &Error{Kind: KindValidation, Err: fmt.Errorf("checkpoint for schedule %s does not match the requested report", resume.ScheduleID)}
+		}
+		for name, pdata := range resume.People {
+			if pdata.DailyHours == nil {
+				pdata.DailyHours = make(map[time.Time]float64)
+			}
+			report.People[name] = pdata
+		}
+		report.CoveredHours = resume.CoveredHours
+		report.Overlaps = resume.Overlaps
+		for name, hours := range resume.ExcludedHours {
+			report.ExcludedHours[name] = hours
+		}
+		from = resume.Next
+	}
+
+	var err error
+	if opts.Exact {
+		err = c.aggregateTimelineHours(report, from, opts)
+	} else {
+		err = c.aggregateSampledHours(report, from, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// MergeReports combines reports over the same range into one, summing each person's
+// hours. The merged ScheduleID joins the source schedule IDs with commas, and its
+// CoveredHours is the average of the reports', so Coverage is their mean coverage.
+// Overlaps are kept per schedule, ordered by start.
+func MergeReports(reports ...*Report) *Report {
+	merged := &Report{People: make(map[string]*PersonData), ExcludedHours: make(map[string]float64)}
+	var ids []string
+	for _, report := range reports {
+		ids = append(ids, report.ScheduleID)
+		merged.Start, merged.End, merged.Location = report.Start, report.End, report.Location
+		merged.WeekdaysOnly = report.WeekdaysOnly
+		merged.Segments = report.Segments
+		merged.add(report)
+		merged.CoveredHours += report.CoveredHours / float64(len(reports))
+	}
+	sort.SliceStable(merged.Overlaps, func(i, j int) bool {
+		return merged.Overlaps[i].Start.Before(merged.Overlaps[j].Start)
+	})
+	merged.ScheduleID = strings.Join(ids, ",")
+	return merged
+}
+
+// JoinReports combines reports of one schedule over non-overlapping ranges, given in time
+// order, into one covering all of them, e.g. a quarter without its change-freeze month.
+// Hours and CoveredHours are summed, Start and End span every range and Segments lists the
+// ranges, so Coverage and RangeHours leave out the time between them.
+func JoinReports(reports ...*Report) *Report {
+	joined := &Report{People: make(map[string]*PersonData), ExcludedHours: make(map[string]float64)}
+	for i, report := range reports {
+		if i == 0 {
+			joined.ScheduleID, joined.Start = report.ScheduleID, report.Start
+		}
+		joined.End, joined.Location = report.End, report.Location
+		joined.WeekdaysOnly = report.WeekdaysOnly
+		if len(report.Segments) > 0 {
+			joined.Segments = append(joined.Segments, report.Segments...)
+		} else {
+			joined.Segments = append(joined.Segments, Range{report.Start, report.End})
+		}
+		joined.add(report)
+		joined.CoveredHours += report.CoveredHours
+	}
+	return joined
+}
+
+// add sums the people, overlaps and excluded hours of report into r
+func (r *Report) add(report *Report) {
+	for name, pdata := range report.People {
+		total, ok := r.People[name]
+		if !ok {
+			total = &PersonData{Name: name, DailyHours: make(map[time.Time]float64)}
+			r.People[name] = total
+		}
+		total.TotalHours += pdata.TotalHours
+		total.BusinessHours += pdata.BusinessHours
+		total.OffHours += pdata.OffHours
+		for day, hours := range pdata.DailyHours {
+			total.DailyHours[day] += hours
+		}
+	}
+	r.Overlaps = append(r.Overlaps, report.Overlaps...)
+	for name, hours := range report.ExcludedHours {
+		r.ExcludedHours[name] += hours
+	}
+}
+
+// canonicalName resolves a recipient through the identity map, if any
+func (opts ReportOptions) canonicalName(userName string) string {
+	if canonical, ok := opts.Identities[strings.ToLower(userName)]; ok {
+		return canonical
+	}
+	return userName
+}
+
+// excluded reports whether the recipient with canonical name userName is left out of the report
+func (opts ReportOptions) excluded(userName string) bool {
+	return opts.Exclude != nil && opts.Exclude(userName)
+}
+
+// TotalExcludedHours sums the report's ExcludedHours
+func (r *Report) TotalExcludedHours() float64 {
+	var total float64
+	for _, hours := range r.ExcludedHours {
+		total += hours
+	}
+	return total
+}
+
+// addPeriod credits userName with [start, end), classifying each piece between hour
+// boundaries as business or off-hours by its start and bucketing it by local day. With
+// WeekdaysOnly, pieces on weekend days are left out.
+func (r *Report) addPeriod(userName string, start, end time.Time, opts ReportOptions) {
+	businessHours := opts.businessHours()
+	loc := businessHours.location()
+	if _, exists := r.People[userName]; !exists {
+		r.People[userName] = &PersonData{Name: userName, TotalHours: 0, DailyHours: make(map[time.Time]float64)}
+	}
+	pdata := r.People[userName]
+	for cursor := start; cursor.Before(end); {
+		day := localDay(cursor, loc)
+		next := cursor.Truncate(time.Hour).Add(time.Hour)
+		if dayEnd := nextDay(day); next.After(dayEnd) {
+			// Zones with a half-hour offset cross midnight inside an hour
+			next = dayEnd
+		}
+		if next.After(end) {
+			next = end
+		}
+		if opts.WeekdaysOnly && isWeekend(day) {
+			cursor = next
+			continue
+		}
+		hours := next.Sub(cursor).Hours()
+		if businessHours.Contains(cursor) {
+			pdata.BusinessHours += hours
+		} else {
+			pdata.OffHours += hours
+		}
+		pdata.TotalHours += hours
+		pdata.DailyHours[day.UTC()] += hours
+		cursor = next
+	}
+}
+
+// aggregateSampledHours queries who is on call once per hour and credits each recipient
+// with a full hour. With WeekdaysOnly, weekend hours are not queried at all.
+func (c *Client) aggregateSampledHours(report *Report, from time.Time, opts ReportOptions) error {
+	// Iterate over each remaining hour in the date range
+	for current := from; current.Before(report.End); current = current.Add(time.Hour) {
+		// The last sample may cover less than an hour of the range
+		hourEnd := current.Add(time.Hour)
+		if hourEnd.After(report.End) {
+			hourEnd = report.End
+		}
+		counted := opts.countedHours(current, hourEnd)
+		if counted == 0 {
+			if opts.Progress != nil {
+				opts.Progress(current)
+			}
+			opts.checkpoint(report, current.Add(time.Hour))
+			continue
+		}
+
+		recipients, err := c.OnCall(report.ScheduleID, current)
+		if err != nil {
+			return err
+		}
+
+		// Process each on-call recipient; aliases of the same person count once per hour
+		seen := make(map[string]bool, len(recipients))
+		excluded := make(map[string]bool)
+		for _, recipient := range recipients {
+			if recipient == "" {
+				continue
+			}
+			userName := opts.canonicalName(recipient)
+			if seen[userName] {
+				continue
+			}
+			if opts.excluded(userName) {
+				if !excluded[userName] {
+					excluded[userName] = true
+					report.ExcludedHours[userName] += counted
+				}
+				continue
+			}
+			seen[userName] = true
+			report.addPeriod(userName, current, hourEnd, opts)
+		}
+		if len(seen) > 0 {
+			report.CoveredHours += counted
+		}
+		if len(seen) > opts.maxConcurrent() {
+			report.addOverlap(current, hourEnd, seen)
+		}
+
+		time.Sleep(opts.RequestInterval)
+		if opts.Progress != nil {
+			opts.Progress(current)
+		}
+		opts.checkpoint(report, current.Add(time.Hour))
+	}
+	return nil
+}
+
+func (opts ReportOptions) maxConcurrent() int {
+	if opts.MaxConcurrent <= 0 {
+		return 1
+	}
+	return opts.MaxConcurrent
+}
+
+// addOverlap records that the people in onCall were on call together during [start, end),
+// extending the last overlap when it ends at start with the same people
+func (r *Report) addOverlap(start, end time.Time, onCall map[string]bool) {
+	people := make([]string, 0, len(onCall))
+	for name := range onCall {
+		people = append(people, name)
+	}
+	sort.Strings(people)
+	if n := len(r.Overlaps); n > 0 {
+		last := &r.Overlaps[n-1]
+		if last.End.Equal(start) && strings.Join(last.People, "\x00") == strings.Join(people, "\x00") {
+			last.End = end
+			return
+		}
+	}
+	r.Overlaps = append(r.Overlaps, Overlap{ScheduleID: r.ScheduleID, Start: start, End: end, People: people})
+}
+
+// addOverlaps records the stretches of spans during which more than opts.MaxConcurrent
+// distinct people were on call
+func (r *Report) addOverlaps(spans []namedSpan, opts ReportOptions) {
+	var boundaries []time.Time
+	for _, s := range spans {
+		boundaries = append(boundaries, s.start, s.end)
+	}
+	sort.Slice(boundaries, func(i, j int) bool {
+		return boundaries[i].Before(boundaries[j])
+	})
+	for i := 1; i < len(boundaries); i++ {
+		from, to := boundaries[i-1], boundaries[i]
+		if !to.After(from) || opts.countedHours(from, to) == 0 {
+			continue
+		}
+		onCall := make(map[string]bool)
+		for _, s := range spans {
+			if !s.start.After(from) && s.end.After(from) {
+				onCall[s.name] = true
+			}
+		}
+		if len(onCall) > opts.maxConcurrent() {
+			r.addOverlap(from, to, onCall)
+		}
+	}
+}
+
+// checkpoint reports the state of report to OnCheckpoint, with next the first instant not yet processed
+func (opts ReportOptions) checkpoint(report *Report, next time.Time) {
+	if opts.OnCheckpoint == nil {
+		return
+	}
+	opts.OnCheckpoint(Checkpoint{
+		ScheduleID:    report.ScheduleID,
+		Start:         report.Start,
+		End:           report.End,
+		Exact:         opts.Exact,
+		WeekdaysOnly:  opts.WeekdaysOnly,
+		Next:          next,
+		People:        copyPeople(report.People),
+		CoveredHours:  report.CoveredHours,
+		Overlaps:      append([]Overlap(nil), report.Overlaps...),
+		ExcludedHours: copyHours(report.ExcludedHours),
+	})
+}
+
+func copyHours(hours map[string]float64) map[string]float64 {
+	copied := make(map[string]float64, len(hours))
+	for name, value := range hours {
+		copied[name] = value
+	}
+	return copied
+}
+
+func copyPeople(people map[string]*PersonData) map[string]*PersonData {
+	copied := make(map[string]*PersonData, len(people))
+	for name, pdata := range people {
+		clone := *pdata
+		clone.DailyHours = make(map[time.Time]float64, len(pdata.DailyHours))
+		for day, hours := range pdata.DailyHours {
+			clone.DailyHours[day] = hours
+		}
+		copied[name] = &clone
+	}
+	return copied
+}
+
+// aggregateTimelineHours credits each recipient with the exact duration of their timeline
+// periods inside the report range, so sub-hour shifts and handoffs count fractionally.
+// Without ClipToRange, periods crossing the range edges are counted in full.
+func (c *Client) aggregateTimelineHours(report *Report, from time.Time, opts ReportOptions) error {
+	start, end := report.Start, report.End
+	// A resumed report already matched the rotation in the chunks it processed
+	rotationFound := opts.Rotation == "" || from.After(start)
+	for chunkStart := from; chunkStart.Before(end); chunkStart = chunkStart.AddDate(0, 0, timelineChunkDays) {
+		chunkEnd := chunkStart.AddDate(0, 0, timelineChunkDays)
+		if chunkEnd.After(end) {
+			chunkEnd = end
+		}
+		days := int(math.Ceil(chunkEnd.Sub(chunkStart).Hours() / 24))
+
+		timeline, err := c.Timeline(report.ScheduleID, chunkStart, days, "days")
+		if err != nil {
+			return err
+		}
+		var covered []span
+		var onCall []namedSpan
+		// Effective spans per canonical name, merged before crediting so aliases of one
+		// person (or one person in several rotations) on call together count once
+		credited := make(map[string][]span)
+		excludedSpans := make(map[string][]span)
+
+		for i, rotation := range timeline.Rotations {
+			if opts.Rotation != "" {
+				if !MatchesRotation(rotation, i, opts.Rotation) {
+					continue
+				}
+				rotationFound = true
+			}
+			for _, period := range rotation.Periods {
+				userName := period.Recipient.Name
+				if userName == "" {
+					continue
+				}
+				userName = opts.canonicalName(userName)
+				periodStart, err1 := time.Parse(time.RFC3339, period.StartDate)
+				periodEnd, err2 := time.Parse(time.RFC3339, period.EndDate)
+				if err1 != nil || err2 != nil {
+					continue
+				}
+
+				// Periods entirely outside the requested range never count
+				if !periodEnd.After(start) || !periodStart.Before(end) {
+					continue
+				}
+				if coveredStart, coveredEnd, ok := clipPeriod(periodStart, periodEnd, chunkStart, chunkEnd); ok {
+					if !opts.excluded(userName) {
+						covered = append(covered, span{coveredStart, coveredEnd})
+						onCall = append(onCall, namedSpan{span{coveredStart, coveredEnd}, userName})
+					}
+				}
+
+				// Chunk boundaries inside the range are always clipped so periods spanning
+				// two chunks are not counted twice; the outer edges only when ClipToRange is set
+				lower, upper := chunkStart, chunkEnd
+				if !opts.ClipToRange {
+					if chunkStart.Equal(start) {
+						lower = time.Time{}
+					}
+					if chunkEnd.Equal(end) {
+						upper = time.Time{}
+					}
+				}
+				effectiveStart, effectiveEnd, ok := clipPeriod(periodStart, periodEnd, lower, upper)
+				if !ok {
+					continue
+				}
+
+				if opts.excluded(userName) {
+					excludedSpans[userName] = append(excludedSpans[userName], span{effectiveStart, effectiveEnd})
+					continue
+				}
+				credited[userName] = append(credited[userName], span{effectiveStart, effectiveEnd})
+			}
+		}
+		for userName, spans := range credited {
+			for _, s := range mergeSpans(spans) {
+				report.addPeriod(userName, s.start, s.end, opts)
+			}
+		}
+		for userName, spans := range excludedSpans {
+			report.ExcludedHours[userName] += unionHours(spans, opts.countedHours)
+		}
+
+		report.CoveredHours += unionHours(covered, opts.countedHours)
+		report.addOverlaps(onCall, opts)
+
+		if opts.Progress != nil {
+			opts.Progress(chunkEnd)
+		}
+		opts.checkpoint(report, chunkEnd)
+	}
+
+	if !rotationFound {
+		return &Error{Kind: KindValidation, Err: fmt.Errorf("rotation %q not found in schedule %s", opts.Rotation, report.ScheduleID)}
+	}
+	return nil
+}
+
+// span is a time interval [start, end)
+type span struct {
+	start, end time.Time
+}
+
+// namedSpan is a span during which name was on call
+type namedSpan struct {
+	span
+	name string
+}
+
+// unionHours returns the hours covered by at least one of spans, counting overlaps once,
+// with hours measuring each merged interval
+func unionHours(spans []span, hours func(start, end time.Time) float64) float64 {
+	var total float64
+	for _, s := range mergeSpans(spans) {
+		total += hours(s.start, s.end)
+	}
+	return total
+}
+
+// mergeSpans sorts spans by start and merges the ones that overlap or touch
+func mergeSpans(spans []span) []span {
+	if len(spans) == 0 {
+		return nil
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start.Before(spans[j].start)
+	})
+	merged := []span{spans[0]}
+	for _, s := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if !s.start.After(last.end) {
+			if s.end.After(last.end) {
+				last.end = s.end
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// MatchesRotation reports whether the rotation at position index (0-based) in a timeline is
+// selected by selector: its ID, its name (case-insensitive) or its 1-based position
+func MatchesRotation(rotation TimelineRotation, index int, selector string) bool {
+	selector = strings.TrimSpace(selector)
+	if rotation.ID == selector || strings.EqualFold(rotation.Name, selector) {
+		return true
+	}
+	position, err := strconv.Atoi(selector)
+	return err == nil && position == index+1
+}
+
+// clipPeriod returns the part of [periodStart, periodEnd) that falls inside [rangeStart, rangeEnd),
+// and false when they do not overlap. A zero rangeStart or rangeEnd leaves that side unbounded.
+func clipPeriod(periodStart, periodEnd, rangeStart, rangeEnd time.Time) (time.Time, time.Time, bool) {
+	effectiveStart := periodStart
+	if !rangeStart.IsZero() && rangeStart.After(effectiveStart) {
+		effectiveStart = rangeStart
+	}
+	effectiveEnd := periodEnd
+	if !rangeEnd.IsZero() && rangeEnd.Before(effectiveEnd) {
+		effectiveEnd = rangeEnd
+	}
+	if !effectiveEnd.After(effectiveStart) {
+		return time.Time{}, time.Time{}, false
+	}
+	return effectiveStart, effectiveEnd, true
+}
@@ -0,0 +1,218 @@
+package opsgenie
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPeriod is a timeline period served by newTestServer
+type testPeriod struct {
+	name       string
+	start, end time.Time
+}
+
+// newTestServer serves the timeline and flat on-calls endpoints of every schedule from the
+// same periods, all in one rotation named "Primary"
+func newTestServer(t testing.TB, periods []testPeriod) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		date, err := time.Parse(time.RFC3339, r.URL.Query().Get("date"))
+		if err != nil {
+			http.Error(w, "bad date", http.StatusBadRequest)
+			return
+		}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/timeline"):
+			rotation := TimelineRotation{ID: "r1", Name: "Primary"}
+			for _, p := range periods {
+				rotation.Periods = append(rotation.Periods, RotationPeriod{
+					StartDate: p.start.Format(time.RFC3339),
+					EndDate:   p.end.Format(time.RFC3339),
+					Recipient: Recipient{Name: p.name},
+				})
+			}
+			var resp TimelineResponse
+			resp.Data.FinalTimeline.Rotations = []TimelineRotation{rotation}
+			json.NewEncoder(w).Encode(resp)
+		case strings.HasSuffix(r.URL.Path, "/on-calls"):
+			var resp OnCallResponse
+			resp.Data.Parent = Parent{ID: "s1", Enabled: true}
+			for _, p := range periods {
+				if !p.start.After(date) && p.end.After(date) {
+					resp.Data.OnCallRecipients = append(resp.Data.OnCallRecipients, p.name)
+				}
+			}
+			json.NewEncoder(w).Encode(resp)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestClient returns a Client talking to srv without region detection
+func newTestClient(srv *httptest.Server) *Client {
+	client := NewClient("test-key")
+	client.BaseURL = srv.URL
+	client.DetectRegion = false
+	client.InitialBackoff = time.Millisecond
+	return client
+}
+
+func at(hour, minute int) time.Time {
+	return time.Date(2025, 1, 6, hour, minute, 0, 0, time.UTC)
+}
+
+func approxEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestReportSampledVersusExact(t *testing.T) {
+	// alice covers the first half hour, bob takes over until 02:00 and 02:00-03:00 is a gap
+	client := newTestClient(newTestServer(t, []testPeriod{
+		{"alice", at(0, 0), at(0, 30)},
+		{"bob", at(0, 30), at(2, 0)},
+	}))
+	start, end := at(0, 0), at(3, 0)
+	tests := []struct {
+		name        string
+		exact       bool
+		want        map[string]float64
+		wantCovered float64
+	}{
+		// Sampling at 00:00, 01:00 and 02:00 credits whoever is on call with the whole hour
+		{"sampled", false, map[string]float64{"alice": 1, "bob": 1}, 2},
+		{"exact", true, map[string]float64{"alice": 0.5, "bob": 1.5}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := client.Report("s1", start, end, ReportOptions{Exact: tt.exact, ClipToRange: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.People) != len(tt.want) {
+				t.Errorf("people = %d, want %d", len(report.People), len(tt.want))
+			}
+			for name, want := range tt.want {
+				pdata, ok := report.People[name]
+				if !ok || !approxEqual(pdata.TotalHours, want) {
+					t.Errorf("%s hours = %+v, want %v", name, pdata, want)
+				}
+			}
+			if !approxEqual(report.CoveredHours, tt.wantCovered) {
+				t.Errorf("covered hours = %v, want %v", report.CoveredHours, tt.wantCovered)
+			}
+			if !approxEqual(report.TotalHours(), 2) {
+				t.Errorf("total hours = %v, want 2", report.TotalHours())
+			}
+		})
+	}
+}
+
+func TestClipPeriod(t *testing.T) {
+	rangeStart, rangeEnd := at(8, 0), at(16, 0)
+	tests := []struct {
+		name                   string
+		periodStart, periodEnd time.Time
+		rangeStart, rangeEnd   time.Time
+		wantStart, wantEnd     time.Time
+		wantOK                 bool
+	}{
+		{"inside", at(9, 0), at(10, 30), rangeStart, rangeEnd, at(9, 0), at(10, 30), true},
+		{"before", at(2, 0), at(6, 0), rangeStart, rangeEnd, time.Time{}, time.Time{}, false},
+		{"after", at(17, 0), at(20, 0), rangeStart, rangeEnd, time.Time{}, time.Time{}, false},
+		{"straddles start", at(6, 0), at(9, 0), rangeStart, rangeEnd, at(8, 0), at(9, 0), true},
+		{"straddles end", at(15, 0), at(18, 0), rangeStart, rangeEnd, at(15, 0), at(16, 0), true},
+		{"covers range", at(0, 0), at(23, 0), rangeStart, rangeEnd, at(8, 0), at(16, 0), true},
+		{"ends at range start", at(6, 0), at(8, 0), rangeStart, rangeEnd, time.Time{}, time.Time{}, false},
+		{"starts at range end", at(16, 0), at(18, 0), rangeStart, rangeEnd, time.Time{}, time.Time{}, false},
+		{"matches range", at(8, 0), at(16, 0), rangeStart, rangeEnd, at(8, 0), at(16, 0), true},
+		{"empty period", at(10, 0), at(10, 0), rangeStart, rangeEnd, time.Time{}, time.Time{}, false},
+		{"reversed period", at(11, 0), at(10, 0), rangeStart, rangeEnd, time.Time{}, time.Time{}, false},
+		{"zero range start", at(2, 0), at(9, 0), time.Time{}, rangeEnd, at(2, 0), at(9, 0), true},
+		{"zero range end", at(15, 0), at(22, 0), rangeStart, time.Time{}, at(15, 0), at(22, 0), true},
+		{"unbounded range", at(2, 0), at(22, 0), time.Time{}, time.Time{}, at(2, 0), at(22, 0), true},
+		{"empty range", at(9, 0), at(10, 0), at(9, 30), at(9, 30), time.Time{}, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStart, gotEnd, ok := clipPeriod(tt.periodStart, tt.periodEnd, tt.rangeStart, tt.rangeEnd)
+			if ok != tt.wantOK || !gotStart.Equal(tt.wantStart) || !gotEnd.Equal(tt.wantEnd) {
+				t.Errorf("clipPeriod() = %v, %v, %v; want %v, %v, %v", gotStart, gotEnd, ok, tt.wantStart, tt.wantEnd, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestReportExactClipping(t *testing.T) {
+	start, end := at(8, 0), at(16, 0)
+	tests := []struct {
+		name        string
+		period      testPeriod
+		clip        bool
+		wantHours   float64 // credited to alice
+		wantCovered float64
+	}{
+		{"inside", testPeriod{"alice", at(9, 0), at(10, 30)}, true, 1.5, 1.5},
+		{"before", testPeriod{"alice", at(2, 0), at(6, 0)}, true, 0, 0},
+		{"after", testPeriod{"alice", at(17, 0), at(20, 0)}, true, 0, 0},
+		{"touches start", testPeriod{"alice", at(6, 0), at(8, 0)}, false, 0, 0},
+		{"touches end", testPeriod{"alice", at(16, 0), at(18, 0)}, false, 0, 0},
+		{"straddles start clipped", testPeriod{"alice", at(6, 0), at(9, 0)}, true, 1, 1},
+		{"straddles start unclipped", testPeriod{"alice", at(6, 0), at(9, 0)}, false, 3, 1},
+		{"straddles end clipped", testPeriod{"alice", at(15, 30), at(18, 0)}, true, 0.5, 0.5},
+		{"straddles end unclipped", testPeriod{"alice", at(15, 30), at(18, 0)}, false, 2.5, 0.5},
+		{"covers range unclipped", testPeriod{"alice", at(0, 0), at(23, 0)}, false, 23, 8},
+		{"empty period", testPeriod{"alice", at(10, 0), at(10, 0)}, true, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(newTestServer(t, []testPeriod{tt.period}))
+			report, err := client.Report("s1", start, end, ReportOptions{Exact: true, ClipToRange: tt.clip})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var hours float64
+			if pdata, ok := report.People["alice"]; ok {
+				hours = pdata.TotalHours
+			}
+			if !approxEqual(hours, tt.wantHours) {
+				t.Errorf("alice hours = %v, want %v", hours, tt.wantHours)
+			}
+			if !approxEqual(report.CoveredHours, tt.wantCovered) {
+				t.Errorf("covered hours = %v, want %v", report.CoveredHours, tt.wantCovered)
+			}
+		})
+	}
+}
+
+func TestReportOverlappingAliases(t *testing.T) {
+	// alice is on call 09:00-11:00 and, under her email address, 10:00-12:00
+	client := newTestClient(newTestServer(t, []testPeriod{
+		{"alice", at(9, 0), at(11, 0)},
+		{"alice@example.com", at(10, 0), at(12, 0)},
+	}))
+	identities := map[string]string{"alice@example.com": "alice"}
+	for _, exact := range []bool{false, true} {
+		report, err := client.Report("s1", at(8, 0), at(13, 0), ReportOptions{Exact: exact, ClipToRange: true, Identities: identities})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pdata, ok := report.People["alice"]
+		if len(report.People) != 1 || !ok || !approxEqual(pdata.TotalHours, 3) {
+			t.Errorf("exact=%v: %d people, alice = %+v, want only alice with 3 hours", exact, len(report.People), pdata)
+		}
+		if !approxEqual(report.TotalHours(), report.CoveredHours) {
+			t.Errorf("exact=%v: total hours = %v, want the covered %v", exact, report.TotalHours(), report.CoveredHours)
+		}
+		if len(report.Overlaps) != 0 {
+			t.Errorf("exact=%v: overlaps = %v, want none", exact, report.Overlaps)
+		}
+	}
+}
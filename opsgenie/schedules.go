@@ -0,0 +1,551 @@
+package opsgenie
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Schedules lists every schedule visible to the API key
+func (c *Client) Schedules() ([]Schedule, error) {
+	schedules, _, err := c.ListSchedules()
+	return schedules, err
+}
+
+// ListSchedules lists every schedule visible to the API key, following paging.next links
+// when the API splits the list, and returns how many pages were fetched
+func (c *Client) ListSchedules() ([]Schedule, int, error) {
+	return c.listSchedules("/schedules")
+}
+
+// SearchSchedules lists the schedules matching an OpsGenie search query, e.g.
+// `name:"Production"`, so the API filters large accounts instead of returning every
+// schedule. Paging is followed as in ListSchedules.
+func (c *Client) SearchSchedules(query string) ([]Schedule, int, error) {
+	return c.listSchedules("/schedules?query=" + url.QueryEscape(query))
+}
+
+func (c *Client) listSchedules(path string) ([]Schedule, int, error) {
+	var schedules []Schedule
+	for pages := 1; ; pages++ {
+		var schedulesResp SchedulesResponse
+		if err := c.getJSON(path, &schedulesResp); err != nil {
+			return nil, pages - 1, fmt.Errorf("failed to fetch schedules: %w", err)
+		}
+		schedules = append(schedules, schedulesResp.Data...)
+
+		next, err := url.Parse(schedulesResp.Paging.Next)
+		if schedulesResp.Paging.Next == "" || err != nil || len(schedulesResp.Data) == 0 {
+			return schedules, pages, nil
+		}
+		// The next link is absolute; keep the query and resolve it against BaseURL
+		nextPath := "/schedules?" + next.RawQuery
+		if nextPath == path {
+			return schedules, pages, nil
+		}
+		path = nextPath
+	}
+}
+
+// OnCall returns the flat list of recipients on call for a schedule at date.
+// With ExpandTeams set, team recipients are replaced by their members; with RecipientType
+// set, only participants of that type are returned. With EmptyRetryDelay set, an empty
+// result is queried once more after that delay.
+func (c *Client) OnCall(scheduleID string, date time.Time) ([]string, error) {
+	recipients, _, err := c.onCallWithParent(scheduleID, date)
+	return recipients, err
+}
+
+// onCallWithParent is OnCall, also returning the schedule as the on-calls response describes it
+func (c *Client) onCallWithParent(scheduleID string, date time.Time) ([]string, Parent, error) {
+	recipients, parent, err := c.onCall(scheduleID, date)
+	if err != nil || len(recipients) > 0 || c.EmptyRetryDelay <= 0 {
+		return recipients, parent, err
+	}
+	time.Sleep(c.EmptyRetryDelay)
+	return c.onCall(scheduleID, date)
+}
+
+func (c *Client) onCall(scheduleID string, date time.Time) ([]string, Parent, error) {
+	if c.ExpandTeams || c.RecipientType != "" {
+		data, err := c.onCallParticipants(scheduleID, date)
+		if err != nil {
+			return nil, Parent{}, err
+		}
+		participants := data.OnCallParticipants
+		if c.RecipientType != "" {
+			participants = participantsOfType(participants, c.RecipientType)
+		}
+		if c.ExpandTeams {
+			recipients, err := c.expandParticipants(participants)
+			return recipients, data.Parent, err
+		}
+		recipients := make([]string, 0, len(participants))
+		for _, participant := range participants {
+			recipients = append(recipients, participant.Name)
+		}
+		return recipients, data.Parent, nil
+	}
+
+	path := fmt.Sprintf("/schedules/%s/on-calls?flat=true&date=%s",
+		scheduleID, url.QueryEscape(date.Format(time.RFC3339)))
+
+	var onCallResp OnCallResponse
+	if err := c.getJSON(path, &onCallResp); err != nil {
+		return nil, Parent{}, fmt.Errorf("failed to fetch on-call: %w", err)
+	}
+	return onCallResp.Data.OnCallRecipients, onCallResp.Data.Parent, nil
+}
+
+// OnCallParticipants returns the typed (non-flat) on-call participants of a schedule at date
+func (c *Client) OnCallParticipants(scheduleID string, date time.Time) ([]OnCallParticipant, error) {
+	data, err := c.onCallParticipants(scheduleID, date)
+	return data.OnCallParticipants, err
+}
+
+func (c *Client) onCallParticipants(scheduleID string, date time.Time) (OnCallData, error) {
+	path := fmt.Sprintf("/schedules/%s/on-calls?flat=false&date=%s",
+		scheduleID, url.QueryEscape(date.Format(time.RFC3339)))
+
+	var onCallResp OnCallResponse
+	if err := c.getJSON(path, &onCallResp); err != nil {
+		return OnCallData{}, fmt.Errorf("failed to fetch on-call participants: %w", err)
+	}
+	return onCallResp.Data, nil
+}
+
+// participantsOfType keeps the top-level participants of the given type
+func participantsOfType(participants []OnCallParticipant, participantType string) []OnCallParticipant {
+	var kept []OnCallParticipant
+	for _, participant := range participants {
+		if participant.Type == participantType {
+			kept = append(kept, participant)
+		}
+	}
+	return kept
+}
+
+// expandParticipants flattens participants into usernames, resolving teams to their
+// members and descending into escalations
+func (c *Client) expandParticipants(participants []OnCallParticipant) ([]string, error) {
+	seen := make(map[string]bool)
+	var recipients []string
+	add := func(name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			recipients = append(recipients, name)
+		}
+	}
+
+	var walk func([]OnCallParticipant) error
+	walk = func(participants []OnCallParticipant) error {
+		for _, participant := range participants {
+			switch participant.Type {
+			case "team":
+				members, err := c.TeamMembers(participant.ID, participant.Name)
+				if err != nil {
+					return err
+				}
+				for _, member := range members {
+					add(member)
+				}
+			case "escalation":
+				if err := walk(participant.OnCallParticipants); err != nil {
+					return err
+				}
+			default:
+				add(participant.Name)
+			}
+		}
+		return nil
+	}
+
+	if err := walk(participants); err != nil {
+		return nil, err
+	}
+	return recipients, nil
+}
+
+// RotationParticipants returns everyone taking part in a schedule's rotations, in rotation
+// order and without duplicates; empty slots are skipped
+func (c *Client) RotationParticipants(scheduleID string) ([]string, error) {
+	var rotationsResp RotationsResponse
+	if err := c.getJSON("/schedules/"+url.PathEscape(scheduleID)+"/rotations", &rotationsResp); err != nil {
+		return nil, fmt.Errorf("failed to fetch rotations: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	var participants []string
+	for _, rotation := range rotationsResp.Data {
+		for _, participant := range rotation.Participants {
+			name := participant.Username
+			if name == "" {
+				name = participant.Name
+			}
+			if name != "" && !seen[name] {
+				seen[name] = true
+				participants = append(participants, name)
+			}
+		}
+	}
+	return participants, nil
+}
+
+// Teams lists every team visible to the API key, without their members
+func (c *Client) Teams() ([]Team, error) {
+	var teamsResp TeamsResponse
+	if err := c.getJSON("/teams", &teamsResp); err != nil {
+		return nil, fmt.Errorf("failed to fetch teams: %w", err)
+	}
+	return teamsResp.Data, nil
+}
+
+// TeamMembers returns the usernames of a team's members, looked up by ID when known and by
+// name otherwise. Results are cached for the lifetime of the Client.
+func (c *Client) TeamMembers(teamID, teamName string) ([]string, error) {
+	key := teamID
+	path := "/teams/" + url.PathEscape(teamID)
+	if teamID == "" {
+		key = teamName
+		path = "/teams/" + url.PathEscape(teamName) + "?identifierType=name"
+	}
+
+	c.teamMu.Lock()
+	members, ok := c.teamCache[key]
+	c.teamMu.Unlock()
+	if ok {
+		return members, nil
+	}
+
+	var teamResp TeamResponse
+	if err := c.getJSON(path, &teamResp); err != nil {
+		return nil, fmt.Errorf("failed to fetch team %s: %w", teamName, err)
+	}
+	members = make([]string, 0, len(teamResp.Data.Members))
+	for _, member := range teamResp.Data.Members {
+		members = append(members, member.User.Username)
+	}
+
+	c.teamMu.Lock()
+	if c.teamCache == nil {
+		c.teamCache = make(map[string][]string)
+	}
+	c.teamCache[key] = members
+	c.teamMu.Unlock()
+
+	return members, nil
+}
+
+// UserContacts returns the contact methods (email, SMS, voice, mobile app) of a user,
+// identified by username or ID. The API key needs configuration access to read users.
+func (c *Client) UserContacts(user string) ([]Contact, error) {
+	var contactsResp ContactsResponse
+	if err := c.getJSON("/users/"+url.PathEscape(user)+"/contacts", &contactsResp); err != nil {
+		return nil, fmt.Errorf("failed to fetch contacts of %s: %w", user, err)
+	}
+	return contactsResp.Data, nil
+}
+
+// NextOnCall returns the flat list of recipients for the on-call shift following date
+func (c *Client) NextOnCall(scheduleID string, date time.Time) ([]string, error) {
+	path := fmt.Sprintf("/schedules/%s/next-on-calls?flat=true&date=%s",
+		scheduleID, url.QueryEscape(date.Format(time.RFC3339)))
+
+	var nextResp NextOnCallResponse
+	if err := c.getJSON(path, &nextResp); err != nil {
+		return nil, fmt.Errorf("failed to fetch next on-call: %w", err)
+	}
+	return nextResp.Data.OnCallRecipients, nil
+}
+
+// Timeline returns the final timeline of a schedule starting at date and spanning
+// interval units, where intervalUnit is one of "hours", "days", "weeks" or "months"
+func (c *Client) Timeline(scheduleID string, date time.Time, interval int, intervalUnit string) (*Timeline, error) {
+	path := fmt.Sprintf("/schedules/%s/timeline?date=%s&interval=%d&intervalUnit=%s",
+		scheduleID, url.QueryEscape(date.Format(time.RFC3339)), interval, intervalUnit)
+
+	var timeline TimelineResponse
+	if err := c.getJSON(path, &timeline); err != nil {
+		return nil, fmt.Errorf("failed to fetch timeline: %w", err)
+	}
+	return &timeline.Data.FinalTimeline, nil
+}
+
+// ShiftEnd returns when the current shift of a schedule ends and whether that is within the
+// next hour. It returns ErrNoCurrentShift when no period covers now, and the lookup error
+// when the timeline could not be fetched.
+func (c *Client) ShiftEnd(scheduleID string, now time.Time) (time.Time, bool, error) {
+	// Request timeline from now to +2 hours
+	timeline, err := c.Timeline(scheduleID, now, 2, "hours")
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	// Check periods in finalTimeline
+	for _, rotation := range timeline.Rotations {
+		for _, period := range rotation.Periods {
+			periodStart, err1 := time.Parse(time.RFC3339, period.StartDate)
+			periodEnd, err2 := time.Parse(time.RFC3339, period.EndDate)
+
+			if err1 != nil || err2 != nil {
+				continue
+			}
+
+			// Check if this is the current period
+			if (periodStart.Before(now) || periodStart.Equal(now)) && periodEnd.After(now) {
+				duration := periodEnd.Sub(now)
+				return periodEnd, duration <= time.Hour, nil
+			}
+		}
+	}
+
+	return time.Time{}, false, ErrNoCurrentShift
+}
+
+// nextShiftLookahead is how far ahead NextShiftStart searches the timeline
+const nextShiftLookahead = 7
+
+// NextShiftStart returns the start of the first timeline period after now within the next
+// week, or a zero time when there is none
+func (c *Client) NextShiftStart(scheduleID string, now time.Time) (time.Time, error) {
+	timeline, err := c.Timeline(scheduleID, now, nextShiftLookahead, "days")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var next time.Time
+	for _, rotation := range timeline.Rotations {
+		for _, period := range rotation.Periods {
+			periodStart, err := time.Parse(time.RFC3339, period.StartDate)
+			if err != nil || !periodStart.After(now) {
+				continue
+			}
+			if next.IsZero() || periodStart.Before(next) {
+				next = periodStart
+			}
+		}
+	}
+	return next, nil
+}
+
+// Status fetches who is on call for a schedule at the given instant and, when that shift
+// ends within the next hour or no one is on call, who is next. With IncludeParticipants set
+// it also lists the schedule's rotation participants.
+func (c *Client) Status(schedule Schedule, at time.Time) *ScheduleStatus {
+	status := &ScheduleStatus{
+		ScheduleID:   schedule.ID,
+		ScheduleName: schedule.Name,
+		Timezone:     schedule.Timezone,
+		At:           at,
+	}
+
+	if c.Rotation != "" {
+		c.rotationStatus(status, at)
+		if status.Err == nil && c.IncludeParticipants {
+			status.Participants, status.ParticipantsErr = c.RotationParticipants(schedule.ID)
+		}
+		return status
+	}
+
+	// Fetch current on-call
+	current, parent, err := c.onCallWithParent(schedule.ID, at)
+	if err != nil {
+		status.Err = err
+		return status
+	}
+	status.CurrentOnCall = current
+	// The on-call data of a disabled schedule may be stale or empty, so its shift timing is
+	// not worth looking up either
+	if parent.ID != "" && !parent.Enabled {
+		status.Disabled = true
+		return status
+	}
+
+	// Check shift timing
+	shiftEnd, endsSoon, err := c.ShiftEnd(schedule.ID, at)
+	switch {
+	case errors.Is(err, ErrNoCurrentShift):
+		status.CoverageGap = true
+	case err != nil:
+		status.ShiftErr = err
+	}
+	status.ShiftEndsAt = shiftEnd
+	status.ShiftEndsSoon = endsSoon
+
+	// Fetch next on-call if shift ends soon, or to show who closes a gap in coverage
+	uncovered := status.CoverageGap || len(current) == 0
+	if endsSoon || uncovered {
+		status.NextOnCall, status.NextErr = c.NextOnCall(schedule.ID, at)
+		status.NoSuccessor = endsSoon && status.NextErr == nil && len(status.NextOnCall) == 0
+	}
+	if uncovered && status.NextErr == nil {
+		status.NextShiftStartsAt, status.NextErr = c.NextShiftStart(schedule.ID, at)
+	}
+	if c.IncludeParticipants {
+		status.Participants, status.ParticipantsErr = c.RotationParticipants(schedule.ID)
+	}
+
+	return status
+}
+
+// rotationStatus fills in status for Rotation alone from the timeline of the week from at:
+// who is on call, when their shift ends and who follows, or who closes a gap and when
+func (c *Client) rotationStatus(status *ScheduleStatus, at time.Time) {
+	periods, err := c.timelinePeriods(status.ScheduleID, at, at.AddDate(0, 0, nextShiftLookahead), c.Rotation)
+	if err != nil {
+		status.Err = err
+		return
+	}
+	onCallAt := func(t time.Time) []string {
+		var names []string
+		for _, p := range periods {
+			if !p.start.After(t) && p.end.After(t) {
+				names = append(names, p.name)
+			}
+		}
+		return uniqueSorted(names)
+	}
+
+	status.CurrentOnCall = onCallAt(at)
+	if len(status.CurrentOnCall) == 0 {
+		status.CoverageGap = true
+		for _, p := range periods {
+			if p.start.After(at) && (status.NextShiftStartsAt.IsZero() || p.start.Before(status.NextShiftStartsAt)) {
+				status.NextShiftStartsAt = p.start
+			}
+		}
+		if !status.NextShiftStartsAt.IsZero() {
+			status.NextOnCall = onCallAt(status.NextShiftStartsAt)
+		}
+		return
+	}
+
+	// The shift ends when the first current period does
+	for _, p := range periods {
+		if !p.start.After(at) && p.end.After(at) && (status.ShiftEndsAt.IsZero() || p.end.Before(status.ShiftEndsAt)) {
+			status.ShiftEndsAt = p.end
+		}
+	}
+	status.ShiftEndsSoon = status.ShiftEndsIn() <= time.Hour
+	if status.ShiftEndsSoon {
+		status.NextOnCall = onCallAt(status.ShiftEndsAt)
+		status.NoSuccessor = len(status.NextOnCall) == 0
+	}
+}
+
+// Statuses fetches the status of every schedule at the same instant with a small bounded
+// pool of concurrent requests. When Context is done before every schedule is back, the
+// statuses fetched so far are returned together with one per remaining schedule whose Err
+// wraps the context's error.
+func (c *Client) Statuses(schedules []Schedule, at time.Time) []*ScheduleStatus {
+	ctx := c.context()
+	// Limit concurrent requests to avoid rate limiting
+	semaphore := make(chan struct{}, 3)
+	results := make(chan *ScheduleStatus, len(schedules))
+	var wg sync.WaitGroup
+
+	for _, schedule := range schedules {
+		wg.Add(1)
+		go func(sched Schedule) {
+			defer wg.Done()
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-semaphore }()
+
+			status := c.Status(sched, at)
+			results <- status
+
+			// Small delay to avoid rate limiting
+			time.Sleep(time.Millisecond * 100)
+		}(schedule)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var statuses []*ScheduleStatus
+	fetched := make(map[string]bool, len(schedules))
+	for done := false; !done; {
+		select {
+		case status, ok := <-results:
+			if !ok {
+				return statuses
+			}
+			statuses = append(statuses, status)
+			fetched[status.ScheduleID] = true
+		case <-ctx.Done():
+			done = true
+		}
+	}
+	// Keep statuses that completed just as the context was done
+	for drained := false; !drained; {
+		select {
+		case status, ok := <-results:
+			if !ok {
+				drained = true
+				break
+			}
+			statuses = append(statuses, status)
+			fetched[status.ScheduleID] = true
+		default:
+			drained = true
+		}
+	}
+
+	// Outstanding fetches see the same context and give up on their own
+	for _, schedule := range schedules {
+		if !fetched[schedule.ID] {
+			statuses = append(statuses, &ScheduleStatus{
+				ScheduleID:   schedule.ID,
+				ScheduleName: schedule.Name,
+				Timezone:     schedule.Timezone,
+				At:           at,
+				Err:          &Error{Kind: KindNetwork, Err: fmt.Errorf("not fetched in time: %w", ctx.Err())},
+			})
+		}
+	}
+	return statuses
+}
+
+// Roster merges the current on-call recipients of statuses into one deduplicated list of
+// people, sorted by name, each with the schedules they cover. Failed lookups and disabled
+// schedules, which page no one, are skipped.
+func Roster(statuses []*ScheduleStatus) []RosterEntry {
+	covered := make(map[string]map[string]bool)
+	for _, status := range statuses {
+		if status.Err != nil || status.Disabled {
+			continue
+		}
+		for _, recipient := range status.CurrentOnCall {
+			if recipient == "" {
+				continue
+			}
+			if covered[recipient] == nil {
+				covered[recipient] = make(map[string]bool)
+			}
+			covered[recipient][status.ScheduleName] = true
+		}
+	}
+
+	roster := make([]RosterEntry, 0, len(covered))
+	for name, schedules := range covered {
+		entry := RosterEntry{Name: name}
+		for schedule := range schedules {
+			entry.Schedules = append(entry.Schedules, schedule)
+		}
+		sort.Strings(entry.Schedules)
+		roster = append(roster, entry)
+	}
+	sort.Slice(roster, func(i, j int) bool {
+		return roster[i].Name < roster[j].Name
+	})
+	return roster
+}
@@ -0,0 +1,59 @@
+package opsgenie
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatusShiftEndsInMatchesShiftEndsSoon(t *testing.T) {
+	srv := newTestServer(t, []testPeriod{
+		{"alice", at(0, 0), at(9, 0)},
+		{"bob", at(9, 0), at(17, 0)},
+	})
+	for _, rotation := range []string{"", "Primary"} {
+		t.Run("rotation="+rotation, func(t *testing.T) {
+			client := newTestClient(srv)
+			client.Rotation = rotation
+			last := time.Duration(-1)
+			// Step towards the 09:00 handoff, across the one hour mark at 08:00
+			for when := at(7, 0); when.Before(at(9, 0)); when = when.Add(10 * time.Minute) {
+				status := client.Status(Schedule{ID: "s1", Name: "Prod"}, when)
+				if status.Err != nil || status.ShiftErr != nil {
+					t.Fatalf("at %s: %v, %v", when.Format("15:04"), status.Err, status.ShiftErr)
+				}
+				if !status.ShiftEndsAt.Equal(at(9, 0)) {
+					t.Fatalf("at %s: ShiftEndsAt = %v, want 09:00", when.Format("15:04"), status.ShiftEndsAt)
+				}
+				in := status.ShiftEndsIn()
+				if want := at(9, 0).Sub(when); in != want {
+					t.Errorf("at %s: ShiftEndsIn() = %v, want %v", when.Format("15:04"), in, want)
+				}
+				if status.ShiftEndsSoon != (in <= time.Hour) {
+					t.Errorf("at %s: ShiftEndsSoon = %v with ShiftEndsIn() = %v", when.Format("15:04"), status.ShiftEndsSoon, in)
+				}
+				if last >= 0 && in >= last {
+					t.Errorf("at %s: ShiftEndsIn() = %v, not less than %v before", when.Format("15:04"), in, last)
+				}
+				last = in
+			}
+		})
+	}
+}
+
+func TestRoster(t *testing.T) {
+	statuses := []*ScheduleStatus{
+		{ScheduleName: "Prod", CurrentOnCall: []string{"alice", "bob"}},
+		{ScheduleName: "Database", CurrentOnCall: []string{"alice", ""}},
+		{ScheduleName: "Legacy", CurrentOnCall: []string{"carol"}, Disabled: true},
+		{ScheduleName: "Search", CurrentOnCall: []string{"dave"}, Err: errors.New("timeout")},
+	}
+	want := []RosterEntry{
+		{Name: "alice", Schedules: []string{"Database", "Prod"}},
+		{Name: "bob", Schedules: []string{"Prod"}},
+	}
+	if got := Roster(statuses); !reflect.DeepEqual(got, want) {
+		t.Errorf("Roster() = %+v, want %+v", got, want)
+	}
+}
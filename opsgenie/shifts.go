@@ -0,0 +1,51 @@
+package opsgenie
+
+import (
+	"sort"
+	"time"
+)
+
+// Shift is one person's uninterrupted stretch on call for a schedule
+type Shift struct {
+	Person string
+	Start  time.Time
+	End    time.Time
+}
+
+// Shifts returns the on-call shifts of a schedule overlapping [start, end) from the final
+// timeline, ordered by start and then person. Back-to-back periods of the same person are
+// merged into one shift; shifts are not clipped to the range. A non-empty rotation limits it
+// to that rotation, as in ReportOptions.Rotation.
+func (c *Client) Shifts(scheduleID string, start, end time.Time, rotation string) ([]Shift, error) {
+	periods, err := c.timelinePeriods(scheduleID, start, end, rotation)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		if periods[i].name != periods[j].name {
+			return periods[i].name < periods[j].name
+		}
+		return periods[i].start.Before(periods[j].start)
+	})
+
+	var shifts []Shift
+	for _, p := range periods {
+		if !p.end.After(start) || !p.start.Before(end) {
+			continue
+		}
+		if n := len(shifts); n > 0 && shifts[n-1].Person == p.name && !p.start.After(shifts[n-1].End) {
+			if p.end.After(shifts[n-1].End) {
+				shifts[n-1].End = p.end
+			}
+			continue
+		}
+		shifts = append(shifts, Shift{Person: p.name, Start: p.start, End: p.end})
+	}
+	sort.SliceStable(shifts, func(i, j int) bool {
+		if !shifts[i].Start.Equal(shifts[j].Start) {
+			return shifts[i].Start.Before(shifts[j].Start)
+		}
+		return shifts[i].Person < shifts[j].Person
+	})
+	return shifts, nil
+}
@@ -0,0 +1,232 @@
+package opsgenie
+
+import "time"
+
+// Structs to parse OpsGenie Who is on Call API responses
+type OnCallResponse struct {
+	Data      OnCallData `json:"data"`
+	Took      float64    `json:"took"`
+	RequestID string     `json:"requestId"`
+}
+
+type OnCallData struct {
+	Parent             Parent              `json:"_parent"`
+	OnCallRecipients   []string            `json:"onCallRecipients"`
+	OnCallParticipants []OnCallParticipant `json:"onCallParticipants"` // only with flat=false
+}
+
+// OnCallParticipant is a user, team or escalation on call; escalations nest their own participants
+type OnCallParticipant struct {
+	ID                 string              `json:"id"`
+	Name               string              `json:"name"`
+	Type               string              `json:"type"`
+	OnCallParticipants []OnCallParticipant `json:"onCallParticipants"`
+}
+
+type Parent struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// List schedules API
+type SchedulesResponse struct {
+	Data      []Schedule `json:"data"`
+	Paging    Paging     `json:"paging"` // only set when the list is split into pages
+	Took      float64    `json:"took"`
+	RequestID string     `json:"requestId"`
+}
+
+type Schedule struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	Timezone string `json:"timezone"`
+}
+
+// Schedule rotations API
+type RotationsResponse struct {
+	Data      []Rotation `json:"data"`
+	Took      float64    `json:"took"`
+	RequestID string     `json:"requestId"`
+}
+
+type Rotation struct {
+	ID           string                `json:"id"`
+	Name         string                `json:"name"`
+	Type         string                `json:"type"` // daily, weekly, hourly
+	Participants []RotationParticipant `json:"participants"`
+}
+
+// RotationParticipant is a slot of a rotation: users have a username, teams and escalations
+// a name, and empty ("none") slots neither
+type RotationParticipant struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+}
+
+// Teams API
+type TeamResponse struct {
+	Data      Team    `json:"data"`
+	Took      float64 `json:"took"`
+	RequestID string  `json:"requestId"`
+}
+
+type TeamsResponse struct {
+	Data      []Team  `json:"data"`
+	Took      float64 `json:"took"`
+	RequestID string  `json:"requestId"`
+}
+
+type Team struct {
+	ID      string       `json:"id"`
+	Name    string       `json:"name"`
+	Members []TeamMember `json:"members"`
+}
+
+type TeamMember struct {
+	User TeamUser `json:"user"`
+	Role string   `json:"role"`
+}
+
+type TeamUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+// User contacts API
+type ContactsResponse struct {
+	Data      []Contact `json:"data"`
+	Took      float64   `json:"took"`
+	RequestID string    `json:"requestId"`
+}
+
+type Contact struct {
+	ID     string        `json:"id"`
+	Method string        `json:"method"` // email, sms, voice or mobile
+	To     string        `json:"to"`
+	Status ContactStatus `json:"status"`
+}
+
+type ContactStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Next on-call API
+type NextOnCallResponse struct {
+	Data      NextOnCallData `json:"data"`
+	Took      float64        `json:"took"`
+	RequestID string         `json:"requestId"`
+}
+
+type NextOnCallData struct {
+	Parent           Parent   `json:"_parent"`
+	OnCallRecipients []string `json:"onCallRecipients"`
+}
+
+// Timeline API (for shift end detection and exact reports)
+type TimelineResponse struct {
+	Data      TimelineData `json:"data"`
+	Took      float64      `json:"took"`
+	RequestID string       `json:"requestId"`
+}
+
+type TimelineData struct {
+	FinalTimeline Timeline `json:"finalTimeline"`
+}
+
+type Timeline struct {
+	Rotations []TimelineRotation `json:"rotations"`
+}
+
+type TimelineRotation struct {
+	ID      string           `json:"id"`
+	Name    string           `json:"name"`
+	Order   float64          `json:"order"`
+	Periods []RotationPeriod `json:"periods"`
+}
+
+type RotationPeriod struct {
+	StartDate string    `json:"startDate"`
+	EndDate   string    `json:"endDate"`
+	Type      string    `json:"type"`
+	Recipient Recipient `json:"recipient"`
+}
+
+type Recipient struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// Alerts API
+type AlertsResponse struct {
+	Data      []Alert `json:"data"`
+	Paging    Paging  `json:"paging"`
+	Took      float64 `json:"took"`
+	RequestID string  `json:"requestId"`
+}
+
+type Paging struct {
+	Next  string `json:"next"`
+	First string `json:"first"`
+	Last  string `json:"last"`
+}
+
+type Alert struct {
+	ID           string    `json:"id"`
+	TinyID       string    `json:"tinyId"`
+	Message      string    `json:"message"`
+	Status       string    `json:"status"`
+	Acknowledged bool      `json:"acknowledged"`
+	Owner        string    `json:"owner"`
+	Priority     string    `json:"priority"` // P1 (highest) to P5
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// Struct to hold aggregated data per person
+type PersonData struct {
+	Name          string
+	TotalHours    float64
+	BusinessHours float64 // part of TotalHours inside the report's business hours
+	OffHours      float64 // part of TotalHours outside them
+	// DailyHours splits TotalHours by calendar day in the report's Location, keyed by the
+	// day's local midnight converted to UTC (see Report.Days)
+	DailyHours map[time.Time]float64
+}
+
+// ScheduleStatus is the current on-call state of a single schedule
+type ScheduleStatus struct {
+	ScheduleID        string
+	ScheduleName      string
+	Timezone          string    // IANA time zone of the schedule
+	At                time.Time // instant the status was queried for
+	CurrentOnCall     []string  // empty when no one is on call
+	NextOnCall        []string
+	ShiftEndsAt       time.Time
+	ShiftEndsSoon     bool      // true if ends within 1 hour
+	CoverageGap       bool      // true if the timeline has no shift covering At
+	NoSuccessor       bool      // true if the shift ends soon and no one is scheduled next
+	NextShiftStartsAt time.Time // only looked up when no one is on call
+	Disabled          bool      // true if the on-calls response reports the schedule as disabled
+	Participants      []string  // everyone in the schedule's rotations, only with Client.IncludeParticipants
+	Err               error     // set when the on-call lookup failed
+	ShiftErr          error     // set when the shift timing lookup failed
+	NextErr           error     // set when the next on-call lookup failed
+	ParticipantsErr   error     // set when the rotation participants lookup failed
+}
+
+// RosterEntry is one person currently on call and the schedules they cover
+type RosterEntry struct {
+	Name      string
+	Schedules []string // schedule names, sorted
+}
+
+// ShiftEndsIn is the time from At until the current shift ends. Computing it against the
+// query instant rather than the clock keeps it consistent with ShiftEndsSoon and across
+// schedules fetched concurrently.
+func (s *ScheduleStatus) ShiftEndsIn() time.Duration {
+	return s.ShiftEndsAt.Sub(s.At)
+}
@@ -0,0 +1,94 @@
+package opsgenie
+
+import (
+	"strings"
+	"time"
+)
+
+// Assignment is a stretch of time a person is expected to be on call
+type Assignment struct {
+	Person string
+	Start  time.Time
+	End    time.Time
+}
+
+// Discrepancy is a stretch of a schedule where the people on call differ from the expected
+// assignments: missing coverage when Actual is empty, unexpected coverage when Expected is
+// empty, and otherwise someone else on call, e.g. an override or a drifted rotation
+type Discrepancy struct {
+	Start    time.Time
+	End      time.Time
+	Expected []string // sorted
+	Actual   []string // sorted
+}
+
+// Kind names the discrepancy: "missing", "unexpected" or "mismatch"
+func (d Discrepancy) Kind() string {
+	switch {
+	case len(d.Actual) == 0:
+		return "missing"
+	case len(d.Expected) == 0:
+		return "unexpected"
+	default:
+		return "mismatch"
+	}
+}
+
+// VerifyAssignments compares the final timeline of a schedule over [start, end) with the
+// expected assignments and returns the stretches where they differ, in chronological order.
+// Names are compared case-insensitively. A non-empty rotation limits the timeline to that
+// rotation, as in ReportOptions.Rotation.
+func (c *Client) VerifyAssignments(scheduleID string, start, end time.Time, expected []Assignment, rotation string) ([]Discrepancy, error) {
+	periods, err := c.timelinePeriods(scheduleID, start, end, rotation)
+	if err != nil {
+		return nil, err
+	}
+
+	// Expected assignments change who should be on call just like timeline periods do
+	all := append([]timelinePeriod(nil), periods...)
+	for _, assignment := range expected {
+		all = append(all, timelinePeriod{assignment.Person, assignment.Start, assignment.End})
+	}
+	edges := append([]time.Time{start}, periodBoundaries(all, start, end)...)
+	edges = append(edges, end)
+
+	var discrepancies []Discrepancy
+	for i := 0; i+1 < len(edges); i++ {
+		from, to := edges[i], edges[i+1]
+		var want, got []string
+		for _, assignment := range expected {
+			if !assignment.Start.After(from) && assignment.End.After(from) {
+				want = append(want, assignment.Person)
+			}
+		}
+		for _, p := range periods {
+			if !p.start.After(from) && p.end.After(from) {
+				got = append(got, p.name)
+			}
+		}
+		want, got = uniqueSorted(want), uniqueSorted(got)
+		if sameNames(want, got) {
+			continue
+		}
+		if n := len(discrepancies); n > 0 && discrepancies[n-1].End.Equal(from) &&
+			equalStrings(discrepancies[n-1].Expected, want) && equalStrings(discrepancies[n-1].Actual, got) {
+			discrepancies[n-1].End = to
+			continue
+		}
+		discrepancies = append(discrepancies, Discrepancy{Start: from, End: to, Expected: want, Actual: got})
+	}
+	return discrepancies, nil
+}
+
+// sameNames reports whether a and b hold the same names, ignoring case and duplicates
+func sameNames(a, b []string) bool {
+	return equalStrings(lowerSet(a), lowerSet(b))
+}
+
+func lowerSet(names []string) []string {
+	lower := make([]string, len(names))
+	for i, name := range names {
+		lower[i] = strings.ToLower(name)
+	}
+	return uniqueSorted(lower)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+func runSchedulesCommand(args []string) error {
+	schedulesFlags := flag.NewFlagSet("schedules", flag.ExitOnError)
+	format := schedulesFlags.String("format", "auto", "Output format: auto (table on a terminal, json when piped), table, json")
+	jsonIndent := addJSONIndentFlag(schedulesFlags)
+
+	clientOpts := addClientFlags(schedulesFlags)
+
+	schedulesFlags.Parse(args)
+
+	*format = resolveFormat(*format, false)
+	switch *format {
+	case "table", "json":
+	default:
+		return validationError("invalid -format value %q (expected auto, table or json)", *format)
+	}
+
+	client, cleanup, err := clientOpts.newClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	schedules, pages, err := client.ListSchedules()
+	if err != nil {
+		return err
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Name < schedules[j].Name
+	})
+
+	if *format == "json" {
+		return writeJSON(os.Stdout, newSchedulesJSON(schedules, pages), *jsonIndent)
+	}
+	fmt.Printf("%-40s %-38s %-8s %s\n", "Name", "ID", "Enabled", "Timezone")
+	fmt.Println(strings.Repeat("=", 110))
+	for _, schedule := range schedules {
+		fmt.Printf("%s %-38s %-8t %s\n", padRight(truncate(schedule.Name, 40), 40), schedule.ID, schedule.Enabled, schedule.Timezone)
+	}
+	fmt.Printf("\n%d schedules\n", len(schedules))
+	return nil
+}
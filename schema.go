@@ -0,0 +1,390 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// jsonSchemas holds the JSON Schema of each command's -format json output, keyed by command
+var jsonSchemas = map[string]string{
+	"alerts": `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "opsgenie-on-call alerts per on-call person",
+  "type": "object",
+  "required": ["schemaVersion", "at", "alertsFetched", "people"],
+  "properties": {
+    "schemaVersion": {"const": 1},
+    "at": {"type": "string", "format": "date-time"},
+    "alertsFetched": {"type": "integer"},
+    "people": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["name", "schedules", "openAlerts", "priorities"],
+        "properties": {
+          "name": {"type": "string"},
+          "schedules": {"type": "array", "items": {"type": "string"}},
+          "openAlerts": {"type": "integer"},
+          "priorities": {"type": "object", "additionalProperties": {"type": "integer"}}
+        }
+      }
+    }
+  }
+}`,
+	"handoffs": `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "opsgenie-on-call handoffs",
+  "type": "object",
+  "required": ["schemaVersion", "scheduleId", "start", "end", "handoffs"],
+  "properties": {
+    "schemaVersion": {"const": 1},
+    "scheduleId": {"type": "string"},
+    "start": {"type": "string", "format": "date-time"},
+    "end": {"type": "string", "format": "date-time"},
+    "handoffs": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["at", "from", "to"],
+        "properties": {
+          "at": {"type": "string", "format": "date-time"},
+          "from": {"type": "array", "items": {"type": "string"}},
+          "to": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    }
+  }
+}`,
+	"validate-coverage": `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "opsgenie-on-call validate-coverage",
+  "type": "object",
+  "required": ["schemaVersion", "scheduleId", "start", "end", "valid", "uncoveredHours", "violations"],
+  "properties": {
+    "schemaVersion": {"const": 1},
+    "scheduleId": {"type": "string"},
+    "start": {"type": "string", "format": "date-time"},
+    "end": {"type": "string", "format": "date-time"},
+    "valid": {"type": "boolean"},
+    "uncoveredHours": {"type": "number", "minimum": 0},
+    "violations": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["kind", "start", "end", "hours", "people"],
+        "properties": {
+          "kind": {"enum": ["gap", "overlap"]},
+          "start": {"type": "string", "format": "date-time"},
+          "end": {"type": "string", "format": "date-time"},
+          "hours": {"type": "number"},
+          "people": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    }
+  }
+}`,
+	"oncall": `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "opsgenie-on-call oncall report",
+  "type": "object",
+  "required": ["schemaVersion", "scheduleId", "start", "end", "people", "totalHours", "totalDays", "totalWeeks", "coveragePercent"],
+  "properties": {
+    "schemaVersion": {"const": 1},
+    "scheduleId": {"type": "string"},
+    "start": {"type": "string", "format": "date-time"},
+    "end": {"type": "string", "format": "date-time"},
+    "ranges": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["start", "end"],
+        "properties": {
+          "start": {"type": "string", "format": "date-time"},
+          "end": {"type": "string", "format": "date-time"}
+        }
+      }
+    },
+    "people": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["name", "hours", "businessHours", "offHours"],
+        "properties": {
+          "name": {"type": "string"},
+          "hours": {"type": "number"},
+          "businessHours": {"type": "number"},
+          "offHours": {"type": "number"},
+          "cost": {"type": "number"},
+          "fte": {"type": "number", "minimum": 0},
+          "coverageWeeks": {"type": "number", "minimum": 0}
+        }
+      }
+    },
+    "totalHours": {"type": "number"},
+    "totalDays": {"type": "number"},
+    "totalWeeks": {"type": "number"},
+    "coveragePercent": {"type": "number", "minimum": 0, "maximum": 100},
+    "totalCost": {"type": "number"},
+    "excludedHours": {"type": "object", "additionalProperties": {"type": "number"}},
+    "teams": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["name", "hours", "businessHours", "offHours", "people"],
+        "properties": {
+          "name": {"type": "string"},
+          "hours": {"type": "number"},
+          "businessHours": {"type": "number"},
+          "offHours": {"type": "number"},
+          "people": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    },
+    "schedules": {"type": "array", "items": {"$ref": "#"}}
+  }
+}`,
+	"oncall-summary": `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "opsgenie-on-call oncall -summary-only report",
+  "type": "object",
+  "required": ["schemaVersion", "scheduleId", "start", "end", "totalHours", "totalDays", "totalWeeks", "coveragePercent"],
+  "properties": {
+    "schemaVersion": {"const": 1},
+    "scheduleId": {"type": "string"},
+    "start": {"type": "string", "format": "date-time"},
+    "end": {"type": "string", "format": "date-time"},
+    "ranges": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["start", "end"],
+        "properties": {
+          "start": {"type": "string", "format": "date-time"},
+          "end": {"type": "string", "format": "date-time"}
+        }
+      }
+    },
+    "totalHours": {"type": "number"},
+    "totalDays": {"type": "number"},
+    "totalWeeks": {"type": "number"},
+    "coveragePercent": {"type": "number", "minimum": 0, "maximum": 100},
+    "totalCost": {"type": "number"},
+    "excludedHours": {"type": "object", "additionalProperties": {"type": "number"}},
+    "teams": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["name", "hours", "businessHours", "offHours", "people"],
+        "properties": {
+          "name": {"type": "string"},
+          "hours": {"type": "number"},
+          "businessHours": {"type": "number"},
+          "offHours": {"type": "number"},
+          "people": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    },
+    "schedules": {"type": "array", "items": {"$ref": "#"}}
+  }
+}`,
+	"schedules": `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "opsgenie-on-call schedules",
+  "type": "object",
+  "required": ["schemaVersion", "count", "pages", "schedules"],
+  "properties": {
+    "schemaVersion": {"const": 1},
+    "count": {"type": "integer"},
+    "pages": {"type": "integer"},
+    "schedules": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["id", "name", "enabled", "timezone"],
+        "properties": {
+          "id": {"type": "string"},
+          "name": {"type": "string"},
+          "enabled": {"type": "boolean"},
+          "timezone": {"type": "string"}
+        }
+      }
+    }
+  }
+}`,
+	"verify": `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "opsgenie-on-call verify",
+  "type": "object",
+  "required": ["schemaVersion", "scheduleId", "start", "end", "valid", "discrepancies"],
+  "properties": {
+    "schemaVersion": {"const": 1},
+    "scheduleId": {"type": "string"},
+    "start": {"type": "string", "format": "date-time"},
+    "end": {"type": "string", "format": "date-time"},
+    "valid": {"type": "boolean"},
+    "discrepancies": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["kind", "start", "end", "hours", "expected", "actual"],
+        "properties": {
+          "kind": {"enum": ["missing", "unexpected", "mismatch"]},
+          "start": {"type": "string", "format": "date-time"},
+          "end": {"type": "string", "format": "date-time"},
+          "hours": {"type": "number"},
+          "expected": {"type": "array", "items": {"type": "string"}},
+          "actual": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    }
+  }
+}`,
+	"whoisoncall": `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "opsgenie-on-call whoisoncall statuses",
+  "type": "object",
+  "required": ["schemaVersion", "at", "schedules"],
+  "properties": {
+    "contacts": {
+      "type": "object",
+      "additionalProperties": {
+        "type": "array",
+        "items": {
+          "type": "object",
+          "required": ["method", "to"],
+          "properties": {
+            "method": {"type": "string"},
+            "to": {"type": "string"}
+          }
+        }
+      }
+    },
+    "schemaVersion": {"const": 1},
+    "at": {"type": "string", "format": "date-time"},
+    "schedules": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["scheduleId", "scheduleName", "currentOnCall", "nextOnCall", "shiftEndsSoon"],
+        "properties": {
+          "scheduleId": {"type": "string"},
+          "scheduleName": {"type": "string"},
+          "timezone": {"type": "string"},
+          "currentOnCall": {"type": "array", "items": {"type": "string"}},
+          "nextOnCall": {"type": "array", "items": {"type": "string"}},
+          "shiftEndsAt": {"type": "string", "format": "date-time"},
+          "shiftEndsSoon": {"type": "boolean"},
+          "coverageGap": {"type": "boolean"},
+          "noSuccessor": {"type": "boolean"},
+          "disabled": {"type": "boolean"},
+          "nextShiftStartsAt": {"type": "string", "format": "date-time"},
+          "error": {"type": "string"},
+          "shiftError": {"type": "string"},
+          "participants": {"type": "array", "items": {"type": "string"}},
+          "participantsError": {"type": "string"}
+        }
+      }
+    }
+  }
+}`,
+	"whoisoncall-compact-json": `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "opsgenie-on-call whoisoncall -format compact-json line",
+  "oneOf": [
+    {
+      "type": "object",
+      "required": ["timestamp", "type", "schemaVersion", "at", "scheduleId", "scheduleName", "currentOnCall", "nextOnCall", "shiftEndsSoon"],
+      "properties": {
+        "timestamp": {"type": "string", "format": "date-time"},
+        "type": {"const": "schedule"},
+        "schemaVersion": {"const": 1},
+        "at": {"type": "string", "format": "date-time"},
+        "scheduleId": {"type": "string"},
+        "scheduleName": {"type": "string"},
+        "timezone": {"type": "string"},
+        "currentOnCall": {"type": "array", "items": {"type": "string"}},
+        "nextOnCall": {"type": "array", "items": {"type": "string"}},
+        "shiftEndsAt": {"type": "string", "format": "date-time"},
+        "shiftEndsSoon": {"type": "boolean"},
+        "coverageGap": {"type": "boolean"},
+        "noSuccessor": {"type": "boolean"},
+        "disabled": {"type": "boolean"},
+        "nextShiftStartsAt": {"type": "string", "format": "date-time"},
+        "error": {"type": "string"},
+        "shiftError": {"type": "string"},
+        "participants": {"type": "array", "items": {"type": "string"}},
+        "participantsError": {"type": "string"}
+      }
+    },
+    {
+      "type": "object",
+      "required": ["timestamp", "type", "schemaVersion", "at", "schedules", "onCall", "empty", "errors", "durationMs"],
+      "properties": {
+        "timestamp": {"type": "string", "format": "date-time"},
+        "type": {"const": "run"},
+        "schemaVersion": {"const": 1},
+        "at": {"type": "string", "format": "date-time"},
+        "schedules": {"type": "integer"},
+        "onCall": {"type": "integer"},
+        "empty": {"type": "integer"},
+        "errors": {"type": "integer"},
+        "durationMs": {"type": "integer"}
+      }
+    }
+  ]
+}`,
+	"whoisoncall-all-recipients": `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "opsgenie-on-call whoisoncall -all-recipients roster",
+  "type": "object",
+  "required": ["schemaVersion", "at", "people"],
+  "properties": {
+    "contacts": {
+      "type": "object",
+      "additionalProperties": {
+        "type": "array",
+        "items": {
+          "type": "object",
+          "required": ["method", "to"],
+          "properties": {
+            "method": {"type": "string"},
+            "to": {"type": "string"}
+          }
+        }
+      }
+    },
+    "schemaVersion": {"const": 1},
+    "at": {"type": "string", "format": "date-time"},
+    "people": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["name", "schedules"],
+        "properties": {
+          "name": {"type": "string"},
+          "schedules": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    }
+  }
+}`,
+}
+
+func runJSONSchemaCommand(args []string) error {
+	var commands []string
+	for command := range jsonSchemas {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	if len(args) != 1 {
+		return validationError("usage: json-schema <%s>", strings.Join(commands, "|"))
+	}
+
+	schema, ok := jsonSchemas[args[0]]
+	if !ok {
+		return validationError("no JSON output for command %q (expected one of: %s)", args[0], strings.Join(commands, ", "))
+	}
+	fmt.Println(schema)
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// stressGrace is how long after a 429 requests may still arrive without counting as
+// ignoring Retry-After: they were already on their way when the limit was hit
+const stressGrace = 100 * time.Millisecond
+
+// stressServer is a mock on-calls endpoint that admits rate requests per second and answers
+// the rest with 429 and Retry-After: 1 while blocking for that second, the way OpsGenie
+// behaves once an account's limit is hit
+type stressServer struct {
+	mu           sync.Mutex
+	rate         int
+	windowStart  time.Time
+	windowCount  int
+	blockedAt    time.Time
+	blockedUntil time.Time
+	limited      int // 429 responses sent
+	early        int // requests that arrived while the client had been told to wait
+	inFlight     int
+	peakInFlight int
+}
+
+func (s *stressServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	s.mu.Lock()
+	s.inFlight++
+	s.peakInFlight = max(s.peakInFlight, s.inFlight)
+	if now.Sub(s.windowStart) >= time.Second {
+		s.windowStart, s.windowCount = now, 0
+	}
+	s.windowCount++
+	blocked := now.Before(s.blockedUntil)
+	if blocked && now.Sub(s.blockedAt) > stressGrace {
+		s.early++
+	}
+	limited := blocked || s.windowCount > s.rate
+	if limited {
+		s.limited++
+		if !blocked {
+			s.blockedAt, s.blockedUntil = now, now.Add(time.Second)
+		}
+	}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+	w.Header().Set("Content-Type", "application/json")
+	if limited {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"message":"You are making too many requests! To avoid errors, we recommend you limit requests."}`)
+		return
+	}
+	fmt.Fprint(w, `{"data":{"onCallRecipients":["stress@example.com"]}}`)
+}
+
+// runStressCommand fires many concurrent on-call requests at a local mock server that rate
+// limits them, and fails unless every request eventually succeeds without ignoring a
+// Retry-After. It is a hidden developer command for checking the client's retry and
+// backoff behaviour; it never talks to OpsGenie.
+func runStressCommand(args []string) error {
+	stressFlags := flag.NewFlagSet("stress", flag.ExitOnError)
+	requests := stressFlags.Int("requests", 200, "Number of on-call requests to send")
+	workers := stressFlags.Int("workers", 10, "Number of requests sent at the same time")
+	rate := stressFlags.Int("rate", 20, "Requests per second the mock server admits before answering 429")
+	maxRetries := stressFlags.Int("max-retries", 5, "Client retries per rate-limited request")
+	adaptive := stressFlags.Int("adaptive", 0, "Cap in-flight requests with the adaptive (AIMD) limit up to this value; 0 disables")
+	verbose := stressFlags.Bool("verbose", false, "Show the client's retry log lines")
+	stressFlags.Parse(args)
+
+	if *requests < 1 || *workers < 1 || *rate < 1 {
+		return validationError("-requests, -workers and -rate must be positive")
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+		defer log.SetOutput(os.Stderr)
+	}
+
+	server := &stressServer{rate: *rate}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	client := opsgenie.NewClient("stress")
+	client.BaseURL = httpServer.URL
+	client.DetectRegion = false
+	client.MaxRetries = *maxRetries
+	client.AdaptiveConcurrency = *adaptive
+
+	jobs := make(chan int)
+	var failed atomic.Int64
+	var firstErr error
+	var errOnce sync.Once
+	var wg sync.WaitGroup
+	started := time.Now()
+	for range *workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if _, err := client.OnCall(fmt.Sprintf("stress-%d", i), started); err != nil {
+					failed.Add(1)
+					errOnce.Do(func() { firstErr = err })
+				}
+			}
+		}()
+	}
+	for i := range *requests {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	elapsed := time.Since(started)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	fmt.Printf("Requests:            %d (%d workers, server limit %d/s)\n", *requests, *workers, *rate)
+	fmt.Printf("Succeeded:           %d\n", int64(*requests)-failed.Load())
+	fmt.Printf("Failed:              %d\n", failed.Load())
+	fmt.Printf("429 responses:       %d\n", server.limited)
+	fmt.Printf("Ignored Retry-After: %d\n", server.early)
+	fmt.Printf("Peak in flight:      %d\n", server.peakInFlight)
+	fmt.Printf("Elapsed:             %s (%.1f requests/s)\n", elapsed.Round(time.Millisecond), float64(*requests)/elapsed.Seconds())
+
+	var problems []error
+	if n := failed.Load(); n > 0 {
+		problems = append(problems, fmt.Errorf("%d requests failed, first: %w", n, firstErr))
+	}
+	if server.early > 0 {
+		problems = append(problems, fmt.Errorf("%d requests arrived while the client had been told to wait", server.early))
+	}
+	return errors.Join(problems...)
+}
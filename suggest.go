@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// maxSuggestions is how many "did you mean" schedules are offered for a name that matched nothing
+const maxSuggestions = 3
+
+// suggestSchedules returns the names of the schedules closest to query by edit distance
+// (case-insensitive), best first, leaving out those too different to be a typo of it
+func suggestSchedules(query string, schedules []opsgenie.Schedule) []string {
+	query = strings.ToLower(strings.TrimSpace(query))
+	maxDistance := max(3, len([]rune(query))/3)
+
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+	for _, schedule := range schedules {
+		distance := levenshtein(query, strings.ToLower(schedule.Name))
+		// Cleaned names let "Pathfinder" find "Pathfinder_schedule"
+		distance = min(distance, levenshtein(query, strings.ToLower(cleanScheduleName(schedule.Name))))
+		if distance <= maxDistance {
+			candidates = append(candidates, candidate{schedule.Name, distance})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	var names []string
+	for _, c := range candidates {
+		if len(names) == maxSuggestions {
+			break
+		}
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// didYouMean formats suggestions as a sentence suffix, or "" when there are none
+func didYouMean(suggestions []string) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+	return `; did you mean "` + strings.Join(suggestions, `", "`) + `"?`
+}
+
+// levenshtein returns the number of single-rune insertions, deletions and substitutions
+// needed to turn a into b
+func levenshtein(a, b string) int {
+	source, target := []rune(a), []rune(b)
+	previous := make([]int, len(target)+1)
+	current := make([]int, len(target)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(source); i++ {
+		current[0] = i
+		for j := 1; j <= len(target); j++ {
+			substitution := previous[j-1]
+			if source[i-1] != target[j-1] {
+				substitution++
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, substitution)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(target)]
+}
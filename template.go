@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFuncs are the helpers available to -template in addition to the text/template builtins
+var templateFuncs = template.FuncMap{
+	"join": func(values []string, sep string) string {
+		return strings.Join(values, sep)
+	},
+	"stripDomain": func(recipient string) string {
+		if at := strings.Index(recipient, "@"); at >= 0 {
+			return recipient[:at]
+		}
+		return recipient
+	},
+	"humanize": humanizeDuration,
+	"rfc3339": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+}
+
+// parseOutputTemplate parses a -template value: the template text itself, or @path to read it from a file
+func parseOutputTemplate(value string) (*template.Template, error) {
+	text := value
+	if path, ok := strings.CutPrefix(value, "@"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, validationError("cannot read template file: %v", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, validationError("invalid -template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// outputTemplate validates -format against -template and parses the template. Setting
+// -template with the default auto format (or table) selects -format template; the
+// returned template is nil when no template is used.
+func outputTemplate(format *string, value string) (*template.Template, error) {
+	if value == "" {
+		if *format == "template" {
+			return nil, validationError("-format template requires -template")
+		}
+		return nil, nil
+	}
+	switch *format {
+	case "auto", "table":
+		*format = "template"
+	case "template":
+	default:
+		return nil, validationError("-template cannot be combined with -format %s", *format)
+	}
+	return parseOutputTemplate(value)
+}
+
+// executeTemplate renders data with tmpl to stdout and ends the output with a newline
+func executeTemplate(tmpl *template.Template, data any) error {
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return fmt.Errorf("failed to execute template: %w", err)
+	}
+	text := out.String()
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	_, err := os.Stdout.WriteString(text)
+	return err
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// runValidateCoverageCommand checks that exactly one person is on call for a schedule at every
+// moment of a range and lists the gaps and overlaps otherwise, failing with
+// errCoverageViolations so it can gate a schedule change in CI
+func runValidateCoverageCommand(args []string) error {
+	validateFlags := flag.NewFlagSet("validate-coverage", flag.ExitOnError)
+	startDateStr := validateFlags.String("start", "", "Start date (YYYY-MM-DD), or time (YYYY-MM-DD HH:MM or RFC3339)")
+	endDateStr := validateFlags.String("end", "", "End date (YYYY-MM-DD, inclusive), or exclusive end time (YYYY-MM-DD HH:MM or RFC3339)")
+	scheduleID := validateFlags.String("schedule", "", "OpsGenie Schedule ID (UUID)")
+	rotation := validateFlags.String("rotation", "", "Only check one rotation (ID, name or 1-based position)")
+	onlyGaps := validateFlags.Bool("only-gaps", false, "Only list gaps (no one on call) and the total uncovered hours; overlaps are ignored")
+	format := validateFlags.String("format", "auto", "Output format: auto (table on a terminal, json when piped), table, json")
+	jsonIndent := addJSONIndentFlag(validateFlags)
+	dateFormat := addDateFormatFlag(validateFlags)
+
+	clientOpts := addClientFlags(validateFlags)
+
+	validateFlags.Parse(args)
+
+	if *startDateStr == "" || *endDateStr == "" || *scheduleID == "" {
+		return validationError("start date, end date, and schedule ID must be provided")
+	}
+	*format = resolveFormat(*format, false)
+	switch *format {
+	case "table", "json":
+	default:
+		return validationError("invalid -format value %q (expected auto, table or json)", *format)
+	}
+
+	startDate, _, err := parseRangeTime(*startDateStr)
+	if err != nil {
+		return validationError("invalid start date format: %v", err)
+	}
+	endDate, endHasTime, err := parseRangeTime(*endDateStr)
+	if err != nil {
+		return validationError("invalid end date format: %v", err)
+	}
+	rangeEnd := endDate
+	if !endHasTime {
+		rangeEnd = endDate.AddDate(0, 0, 1)
+	}
+	if !rangeEnd.After(startDate) {
+		return validationError("end must be after start")
+	}
+
+	client, cleanup, err := clientOpts.newClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	violations, err := client.CoverageViolations(*scheduleID, startDate, rangeEnd, *rotation)
+	if err != nil {
+		return err
+	}
+	if *onlyGaps {
+		violations = coverageGaps(violations)
+	}
+
+	if *format == "json" {
+		if err := writeJSON(os.Stdout, newCoverageJSON(*scheduleID, startDate, rangeEnd, violations), *jsonIndent); err != nil {
+			return err
+		}
+	} else {
+		dates := humanDates{layout: *dateFormat}
+		if len(violations) == 0 && *onlyGaps {
+			fmt.Printf("Someone is on call at every moment from %s to %s.\n", dates.time(startDate), dates.time(rangeEnd))
+		} else if len(violations) == 0 {
+			fmt.Printf("Exactly one person is on call from %s to %s.\n", dates.time(startDate), dates.time(rangeEnd))
+		}
+		for _, violation := range violations {
+			if *onlyGaps {
+				fmt.Printf("%s — %s (%s)\n", dates.time(violation.Start), dates.time(violation.End), humanizeDuration(violation.End.Sub(violation.Start)))
+				continue
+			}
+			fmt.Printf("%s — %s (%s): %s\n", dates.time(violation.Start), dates.time(violation.End),
+				humanizeDuration(violation.End.Sub(violation.Start)), describeViolation(violation))
+		}
+		if *onlyGaps && len(violations) > 0 {
+			fmt.Printf("\nTotal uncovered: %.2f hours in %d gaps\n", uncoveredHours(violations), len(violations))
+		}
+	}
+	return coverageResult(violations)
+}
+
+// coverageGaps keeps only the gaps of violations, for -only-gaps
+func coverageGaps(violations []opsgenie.CoverageViolation) []opsgenie.CoverageViolation {
+	var gaps []opsgenie.CoverageViolation
+	for _, violation := range violations {
+		if violation.Gap() {
+			gaps = append(gaps, violation)
+		}
+	}
+	return gaps
+}
+
+// uncoveredHours sums the hours of the gaps in violations
+func uncoveredHours(violations []opsgenie.CoverageViolation) float64 {
+	var hours float64
+	for _, violation := range violations {
+		if violation.Gap() {
+			hours += violation.End.Sub(violation.Start).Hours()
+		}
+	}
+	return hours
+}
+
+// describeViolation phrases a violation for the table, e.g. "overlap: alice, bob"
+func describeViolation(violation opsgenie.CoverageViolation) string {
+	if violation.Gap() {
+		return "gap, no one on call"
+	}
+	return "overlap: " + strings.Join(violation.People, ", ")
+}
+
+// coverageResult returns an errCoverageViolations error counting the gaps and overlaps, or
+// nil when there are none
+func coverageResult(violations []opsgenie.CoverageViolation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	gaps := 0
+	for _, violation := range violations {
+		if violation.Gap() {
+			gaps++
+		}
+	}
+	return fmt.Errorf("%w: %d gaps, %d overlaps", errCoverageViolations, gaps, len(violations)-gaps)
+}
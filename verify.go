@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// runVerifyCommand compares a schedule's timeline with an expected rotation from a CSV file
+// and lists where they differ, failing with errRotationDrift so it can run from cron or CI
+func runVerifyCommand(args []string) error {
+	verifyFlags := flag.NewFlagSet("verify", flag.ExitOnError)
+	expectedPath := verifyFlags.String("expected", "", "CSV file of start,end,person rows: who should be on call when")
+	scheduleID := verifyFlags.String("schedule", "", "OpsGenie Schedule ID (UUID)")
+	rotation := verifyFlags.String("rotation", "", "Only compare one rotation (ID, name or 1-based position)")
+	format := verifyFlags.String("format", "auto", "Output format: auto (table on a terminal, json when piped), table, json")
+	jsonIndent := addJSONIndentFlag(verifyFlags)
+	dateFormat := addDateFormatFlag(verifyFlags)
+
+	clientOpts := addClientFlags(verifyFlags)
+
+	verifyFlags.Parse(args)
+
+	if *expectedPath == "" || *scheduleID == "" {
+		return validationError("-expected and -schedule must be provided")
+	}
+	*format = resolveFormat(*format, false)
+	switch *format {
+	case "table", "json":
+	default:
+		return validationError("invalid -format value %q (expected auto, table or json)", *format)
+	}
+
+	expected, err := loadAssignments(*expectedPath)
+	if err != nil {
+		return err
+	}
+	// The comparison covers the span of the expected rotation
+	start, end := expected[0].Start, expected[0].End
+	for _, assignment := range expected {
+		if assignment.Start.Before(start) {
+			start = assignment.Start
+		}
+		if assignment.End.After(end) {
+			end = assignment.End
+		}
+	}
+
+	client, cleanup, err := clientOpts.newClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	discrepancies, err := client.VerifyAssignments(*scheduleID, start, end, expected, *rotation)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		if err := writeJSON(os.Stdout, newVerifyJSON(*scheduleID, start, end, discrepancies), *jsonIndent); err != nil {
+			return err
+		}
+	} else {
+		dates := humanDates{layout: *dateFormat}
+		if len(discrepancies) == 0 {
+			fmt.Printf("The schedule matches the expected rotation from %s to %s.\n", dates.time(start), dates.time(end))
+		}
+		for _, discrepancy := range discrepancies {
+			fmt.Printf("%s — %s (%s): %s\n", dates.time(discrepancy.Start), dates.time(discrepancy.End),
+				humanizeDuration(discrepancy.End.Sub(discrepancy.Start)), describeDiscrepancy(discrepancy))
+		}
+	}
+	return verifyResult(discrepancies)
+}
+
+// loadAssignments reads start,end,person rows from a CSV file, with start and end as for
+// -start and -end (a date-only end covers that whole day). Blank lines and lines starting
+// with # are ignored.
+func loadAssignments(path string) ([]opsgenie.Assignment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, validationError("cannot open expected rotation: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = 3
+	reader.TrimLeadingSpace = true
+
+	var assignments []opsgenie.Assignment
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, validationError("invalid expected rotation %s: %v", path, err)
+		}
+		line, _ := reader.FieldPos(0)
+		start, _, err := parseRangeTime(record[0])
+		if err != nil {
+			return nil, validationError("%s line %d: invalid start: %v", path, line, err)
+		}
+		end, endHasTime, err := parseRangeTime(record[1])
+		if err != nil {
+			return nil, validationError("%s line %d: invalid end: %v", path, line, err)
+		}
+		if !endHasTime {
+			end = end.AddDate(0, 0, 1)
+		}
+		person := strings.TrimSpace(record[2])
+		if person == "" || !end.After(start) {
+			return nil, validationError("%s line %d: expected a person and an end after the start", path, line)
+		}
+		assignments = append(assignments, opsgenie.Assignment{Person: person, Start: start, End: end})
+	}
+	if len(assignments) == 0 {
+		return nil, validationError("expected rotation %s lists no assignments", path)
+	}
+	return assignments, nil
+}
+
+// describeDiscrepancy phrases a discrepancy for the table, e.g. "expected alice, but bob on call"
+func describeDiscrepancy(discrepancy opsgenie.Discrepancy) string {
+	expected, actual := strings.Join(discrepancy.Expected, ", "), strings.Join(discrepancy.Actual, ", ")
+	switch discrepancy.Kind() {
+	case "missing":
+		return "missing coverage, expected " + expected
+	case "unexpected":
+		return "unexpected coverage by " + actual
+	default:
+		return "expected " + expected + ", but " + actual + " on call"
+	}
+}
+
+// verifyResult returns an errRotationDrift error counting the discrepancies, or nil when
+// there are none
+func verifyResult(discrepancies []opsgenie.Discrepancy) error {
+	if len(discrepancies) == 0 {
+		return nil
+	}
+	var total time.Duration
+	for _, discrepancy := range discrepancies {
+		total += discrepancy.End.Sub(discrepancy.Start)
+	}
+	return fmt.Errorf("%w: %d discrepancies over %s", errRotationDrift, len(discrepancies), humanizeDuration(total))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// statusSnapshot is the part of a schedule status that watch mode compares between polls
+// and -since-last-run saves between runs
+type statusSnapshot struct {
+	ScheduleName  string
+	CurrentOnCall string
+	NextOnCall    string
+	ShiftEndsSoon bool
+}
+
+func snapshotStatuses(statuses []*opsgenie.ScheduleStatus) map[string]statusSnapshot {
+	snapshots := make(map[string]statusSnapshot, len(statuses))
+	for _, status := range statuses {
+		if status.Err != nil {
+			continue
+		}
+		snapshots[status.ScheduleID] = statusSnapshot{
+			ScheduleName:  status.ScheduleName,
+			CurrentOnCall: formatRecipients(status.CurrentOnCall),
+			NextOnCall:    formatRecipients(status.NextOnCall),
+			ShiftEndsSoon: status.ShiftEndsSoon,
+		}
+	}
+	return snapshots
+}
+
+// diffStatuses describes what changed between two polls, in the order of current; shift
+// timing changes are only included with shiftChanges. Schedules that failed to fetch in
+// either poll are skipped rather than reported as changed.
+func diffStatuses(previous map[string]statusSnapshot, current []*opsgenie.ScheduleStatus, shiftChanges bool) []string {
+	currentSnapshots := snapshotStatuses(current)
+
+	var changes []string
+	for _, status := range current {
+		cur, ok := currentSnapshots[status.ScheduleID]
+		if !ok {
+			continue
+		}
+		prev, ok := previous[status.ScheduleID]
+		if !ok {
+			continue
+		}
+
+		name := cleanScheduleName(cur.ScheduleName)
+		switch {
+		case prev.CurrentOnCall == cur.CurrentOnCall:
+		case cur.CurrentOnCall == "":
+			changes = append(changes, fmt.Sprintf("%s: no one on call any more (was %s)", name, prev.CurrentOnCall))
+		default:
+			changes = append(changes, fmt.Sprintf("%s: on-call changed from %s to %s",
+				name, orNobody(prev.CurrentOnCall), orNobody(cur.CurrentOnCall)))
+		}
+		if shiftChanges && prev.ShiftEndsSoon != cur.ShiftEndsSoon {
+			if cur.ShiftEndsSoon {
+				changes = append(changes, fmt.Sprintf("%s: shift ends soon, next on-call %s", name, orNobody(cur.NextOnCall)))
+			} else {
+				changes = append(changes, fmt.Sprintf("%s: shift no longer ending soon", name))
+			}
+		}
+	}
+	return changes
+}
+
+func orNobody(recipients string) string {
+	if recipients == "" {
+		return "(no one)"
+	}
+	return recipients
+}
+
+// watchStatuses polls at every interval until the process is interrupted. With onChange,
+// the first poll is emitted in full and later polls only print timestamped deltas.
+// timestamps prefixes every full emit with the poll time (for human-readable output).
+func watchStatuses(fetch func() []*opsgenie.ScheduleStatus, emit func([]*opsgenie.ScheduleStatus) error, interval time.Duration, onChange, timestamps bool) error {
+	var previous map[string]statusSnapshot
+	for {
+		statuses := fetch()
+		now := time.Now()
+
+		switch {
+		case !onChange:
+			if timestamps {
+				fmt.Printf("\n%s\n", now.Format(time.RFC3339))
+			}
+			if err := emit(statuses); err != nil {
+				return err
+			}
+		case previous == nil:
+			if err := emit(statuses); err != nil {
+				return err
+			}
+		default:
+			for _, change := range diffStatuses(previous, statuses, true) {
+				fmt.Printf("%s %s\n", now.Format(time.RFC3339), change)
+			}
+		}
+
+		previous = mergeSnapshots(previous, statuses)
+
+		time.Sleep(interval)
+	}
+}
+
+// mergeSnapshots returns the snapshots of statuses, keeping the last known snapshot from
+// previous for schedules that failed this time
+func mergeSnapshots(previous map[string]statusSnapshot, statuses []*opsgenie.ScheduleStatus) map[string]statusSnapshot {
+	next := snapshotStatuses(statuses)
+	for id, snapshot := range previous {
+		if _, ok := next[id]; !ok {
+			next[id] = snapshot
+		}
+	}
+	return next
+}
+
+// sinceLastRun prints what changed since the snapshots saved at statePath by the previous
+// run, then saves the current ones. The first run, without a state file, only saves.
+func sinceLastRun(statePath string, statuses []*opsgenie.ScheduleStatus) error {
+	var previous map[string]statusSnapshot
+	data, err := os.ReadFile(statePath)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		log.Printf("No previous run state at %s; saving this run as the baseline", statePath)
+	case err != nil:
+		return validationError("cannot read -since-last-run state: %v", err)
+	default:
+		if err := json.Unmarshal(data, &previous); err != nil {
+			return validationError("invalid -since-last-run state %s: %v", statePath, err)
+		}
+	}
+
+	now := time.Now()
+	for _, change := range diffStatuses(previous, statuses, false) {
+		fmt.Printf("%s %s\n", now.Format(time.RFC3339), change)
+	}
+
+	var encodeErr error
+	err = writeFileAtomically(statePath, func(w io.Writer) {
+		encodeErr = json.NewEncoder(w).Encode(mergeSnapshots(previous, statuses))
+	})
+	if err == nil && encodeErr != nil {
+		err = fmt.Errorf("failed to encode -since-last-run state: %w", encodeErr)
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+// handoffWebhookJSON is the body POSTed to -webhook-url when a schedule's shift starts
+// ending within the hour
+type handoffWebhookJSON struct {
+	SchemaVersion int      `json:"schemaVersion"`
+	Event         string   `json:"event"` // "shift_ends_soon"
+	ScheduleID    string   `json:"scheduleId"`
+	ScheduleName  string   `json:"scheduleName"`
+	ShiftEndsAt   string   `json:"shiftEndsAt"`
+	CurrentOnCall []string `json:"currentOnCall"`
+	NextOnCall    []string `json:"nextOnCall"`
+	NoSuccessor   bool     `json:"noSuccessor"`
+}
+
+// handoffNotifier POSTs a handoffWebhookJSON for every upcoming handoff, once per handoff:
+// a schedule is notified again only when its shift end changes, so polls during the last
+// hour of a shift (or a flapping ShiftEndsSoon) do not repeat the reminder
+type handoffNotifier struct {
+	url        string
+	httpClient *http.Client
+	notified   map[string]time.Time // schedule ID -> shift end already notified
+}
+
+func newHandoffNotifier(webhookURL string, timeout time.Duration) (*handoffNotifier, error) {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, validationError("invalid -webhook-url %q (expected an http or https URL)", webhookURL)
+	}
+	return &handoffNotifier{
+		url:        webhookURL,
+		httpClient: &http.Client{Timeout: timeout},
+		notified:   make(map[string]time.Time),
+	}, nil
+}
+
+// check notifies the handoffs in statuses not notified yet. Failed deliveries are logged
+// and retried on the next poll.
+func (n *handoffNotifier) check(statuses []*opsgenie.ScheduleStatus) {
+	for _, status := range statuses {
+		if status.Err != nil || !status.ShiftEndsSoon || status.ShiftEndsAt.IsZero() {
+			continue
+		}
+		if notified, ok := n.notified[status.ScheduleID]; ok && notified.Equal(status.ShiftEndsAt) {
+			continue
+		}
+		if err := n.post(status); err != nil {
+			log.Printf("Warning: handoff webhook for schedule %s failed: %v", status.ScheduleName, err)
+			continue
+		}
+		n.notified[status.ScheduleID] = status.ShiftEndsAt
+	}
+}
+
+func (n *handoffNotifier) post(status *opsgenie.ScheduleStatus) error {
+	body, err := json.Marshal(handoffWebhookJSON{
+		SchemaVersion: jsonSchemaVersion,
+		Event:         "shift_ends_soon",
+		ScheduleID:    status.ScheduleID,
+		ScheduleName:  status.ScheduleName,
+		ShiftEndsAt:   status.ShiftEndsAt.Format(time.RFC3339),
+		CurrentOnCall: nonNil(status.CurrentOnCall),
+		NextOnCall:    nonNil(status.NextOnCall),
+		NoSuccessor:   status.NoSuccessor,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := n.httpClient.Post(n.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+)
+
+// runWhoCommand prints only the people on call for one schedule at one instant, one per
+// line, for scripts that stamp incident or deploy metadata with the on-call person
+func runWhoCommand(args []string) error {
+	whoFlags := flag.NewFlagSet("who", flag.ExitOnError)
+	scheduleID := whoFlags.String("schedule", "", "OpsGenie schedule ID (UUID) or name")
+	atFlag := whoFlags.String("at", "", "RFC3339 instant to look up, e.g. a deploy or commit time (default: now)")
+	expandTeams := whoFlags.Bool("expand-teams", false, "Replace team recipients with their member users")
+
+	clientOpts := addClientFlags(whoFlags)
+
+	whoFlags.Parse(args)
+
+	if *scheduleID == "" {
+		return validationError("-schedule must be provided")
+	}
+	at := time.Now().UTC()
+	if *atFlag != "" {
+		parsed, err := time.Parse(time.RFC3339, *atFlag)
+		if err != nil {
+			return validationError("invalid -at timestamp (expected RFC3339, e.g. 2024-12-01T08:00:00Z): %v", err)
+		}
+		at = parsed.UTC()
+	}
+
+	client, cleanup, err := clientOpts.newClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	client.ExpandTeams = *expandTeams
+
+	ids, err := resolveScheduleIDs(client, []string{*scheduleID})
+	if err != nil {
+		return err
+	}
+	recipients, err := client.OnCall(ids[0], at)
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		log.Printf("Warning: no one on call for schedule %s at %s", *scheduleID, at.Format(time.RFC3339))
+	}
+	for _, recipient := range recipients {
+		fmt.Println(recipient)
+	}
+	return nil
+}
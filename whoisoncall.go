@@ -0,0 +1,1146 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+func runWhoIsOnCallCommand(args []string) error {
+	return runScheduleStatusCommand("whoisoncall", args)
+}
+
+// runWhoIsOnCommand is whoisoncall for a required -date, for planning who covers a future day
+func runWhoIsOnCommand(args []string) error {
+	return runScheduleStatusCommand("whoson", args)
+}
+
+func runScheduleStatusCommand(command string, args []string) error {
+	// Create flag set for whoisoncall subcommand
+	whoisFlags := flag.NewFlagSet(command, flag.ExitOnError)
+	filterFlag := whoisFlags.String("filter", "", "Comma-separated list of schedule names or IDs to filter")
+	filterFile := whoisFlags.String("filter-file", "", "File of schedule names or IDs to filter, one per line (# comments allowed); combined with -filter")
+	namesOnly := whoisFlags.Bool("names-only", false, "Print only the deduplicated names of people currently on call")
+	oneline := whoisFlags.Bool("oneline", false, "Print a single line like \"Production: alice (handoff in 45m)\" for status bars, schedules joined by \" | \"")
+	allRecipients := whoisFlags.Bool("all-recipients", false, "Print one deduplicated roster of everyone on call with the schedules each covers (all schedules unless -filter is given)")
+	format := whoisFlags.String("format", "auto", "Output format: auto (table on a terminal, json when piped), table, json, compact-json, prometheus-textfile, template, grafana")
+	templateFlag := whoisFlags.String("template", "", "Go text/template (or @file) executed against the schedule statuses; implies -format template")
+	output := whoisFlags.String("output", "", "Output file (required for -format prometheus-textfile)")
+	listen := whoisFlags.String("listen", "", "Address to serve the Grafana Simple JSON datasource on (required for -format grafana, e.g. :8080)")
+	sortMode := whoisFlags.String("sort", "name", "Sort order: name, shift-end (soonest first), status (empty schedules first)")
+	watch := whoisFlags.Duration("watch", 0, "Refresh at this interval until interrupted (e.g. 1m)")
+	onChange := whoisFlags.Bool("on-change", false, "With -watch, only print a timestamped delta when on-call people or handoff status change")
+	webhookURL := whoisFlags.String("webhook-url", "", "With -watch, POST a JSON reminder to this URL once per handoff when a shift starts ending within the hour")
+	atFlag := whoisFlags.String("at", "", "Show who was (or will be) on call at this RFC3339 instant instead of now")
+	expandTeams := whoisFlags.Bool("expand-teams", false, "Replace team recipients with their member users (uses the teams API)")
+	recipientType := whoisFlags.String("recipient-type", "", "Only show on-call participants of this type: user, team or escalation")
+	rotation := whoisFlags.String("rotation", "", "Only show one rotation of each schedule (ID, name or 1-based position), from the schedule timeline")
+	sinceLastRunPath := whoisFlags.String("since-last-run", "", "State file: print only on-call changes since the run that last wrote it, then update it (for cron notifications)")
+	showContacts := whoisFlags.Bool("contacts", false, "Also show the contact methods (email, phone) of everyone on call; sensitive, needs configuration access")
+	retryOnEmpty := whoisFlags.Bool("retry-on-empty", false, "Query a schedule once more after 2s when no one is on call, to ride out transient empty results at handoffs")
+	enabledOnly := addEnabledOnlyFlag(whoisFlags)
+	clientSideFilter := addClientSideFilterFlag(whoisFlags)
+	compactEmpty := whoisFlags.Bool("compact-empty", false, "Collapse schedules with no one on call into a single footer line")
+	absoluteTimes := whoisFlags.Bool("absolute-times", false, "Show when shifts end or start as clock times in each schedule's time zone instead of \"in 45m\"")
+	failIfSoon := whoisFlags.Bool("fail-if-soon", false, "Exit with code 5 if any matched schedule's shift ends within the hour (for deploy gating)")
+	jsonIndent := addJSONIndentFlag(whoisFlags)
+	summaryJSON := whoisFlags.String("summary-json", "", "With table output, also write the -format json document to this file, atomically")
+	colorFlag := addColorFlag(whoisFlags)
+	normalize := whoisFlags.Bool("normalize-names", false, "Show people as title-cased display names (john.doe@example.com -> John Doe) in tables; JSON keeps the raw values")
+	dateFormat := addDateFormatFlag(whoisFlags)
+	showTZ := whoisFlags.Bool("show-tz", false, "Add a column with each schedule's time zone and its local time")
+	columnsFlag := whoisFlags.String("columns", "", "Comma-separated table columns in display order: name, current, next, tz, shift_end, participants (default name,current,next)")
+	maxWidth := whoisFlags.Int("max-width", 0, "Width of the people columns (current, next, participants); people who do not fit are shown as \"+N more\" (default: 50, 60 for participants)")
+	showParticipants := whoisFlags.Bool("show-participants", false, "Also list everyone in each schedule's rotations, not just who is on call now")
+	var dateFlag *string
+	if command == "whoson" {
+		dateFlag = whoisFlags.String("date", "", "Date (YYYY-MM-DD, midnight UTC) or time (YYYY-MM-DD HH:MM or RFC3339) to show the on-call for")
+	}
+
+	clientOpts := addClientFlags(whoisFlags)
+	clientOpts.addFromFileFlag(whoisFlags)
+
+	whoisFlags.Parse(args)
+
+	tmpl, err := outputTemplate(format, *templateFlag)
+	if err != nil {
+		return err
+	}
+	*format = resolveFormat(*format, *namesOnly || *oneline || *sinceLastRunPath != "" || *summaryJSON != "")
+	switch *format {
+	case "table", "json", "compact-json", "template":
+	case "prometheus-textfile":
+		if *output == "" {
+			return validationError("-format prometheus-textfile requires -output <path>")
+		}
+	case "grafana":
+		if *listen == "" {
+			return validationError("-format grafana requires -listen <address>")
+		}
+		if *watch > 0 || *atFlag != "" || dateFlag != nil || *namesOnly || *allRecipients || *showContacts || *failIfSoon {
+			return validationError("-format grafana cannot be combined with -watch, -at, whoson, -names-only, -all-recipients, -contacts or -fail-if-soon")
+		}
+	default:
+		return validationError("invalid -format value %q (expected auto, table, json, compact-json, prometheus-textfile, template or grafana)", *format)
+	}
+	if *listen != "" && *format != "grafana" {
+		return validationError("-listen requires -format grafana")
+	}
+	switch *sortMode {
+	case "name", "shift-end", "status":
+	default:
+		return validationError("invalid -sort value %q (expected name, shift-end or status)", *sortMode)
+	}
+	if *watch < 0 {
+		return validationError("-watch must be positive")
+	}
+	switch *recipientType {
+	case "", "user", "team", "escalation":
+	default:
+		return validationError("invalid -recipient-type value %q (expected user, team or escalation)", *recipientType)
+	}
+	if *recipientType != "" && *recipientType != "team" && *expandTeams {
+		return validationError("-expand-teams only applies to -recipient-type team")
+	}
+	if *rotation != "" && (*recipientType != "" || *expandTeams || *retryOnEmpty) {
+		return validationError("-rotation cannot be combined with -recipient-type, -expand-teams or -retry-on-empty")
+	}
+	if *clientOpts.timeout > 0 && *watch > 0 {
+		return validationError("-timeout cannot be combined with -watch")
+	}
+	if *failIfSoon && *watch > 0 {
+		return validationError("-fail-if-soon cannot be combined with -watch")
+	}
+	if *onChange && *watch == 0 {
+		return validationError("-on-change requires -watch")
+	}
+	if *webhookURL != "" && *watch == 0 {
+		return validationError("-webhook-url requires -watch")
+	}
+	if *onChange && (*format == "prometheus-textfile" || *format == "compact-json") {
+		return validationError("-on-change cannot be combined with -format prometheus-textfile or compact-json")
+	}
+	if *allRecipients && (*namesOnly || *format == "prometheus-textfile" || *format == "template" || *format == "compact-json") {
+		return validationError("-all-recipients cannot be combined with -names-only or -format prometheus-textfile/template/compact-json")
+	}
+	if *namesOnly && (*format == "template" || *format == "compact-json") {
+		return validationError("-names-only cannot be combined with -format template or compact-json")
+	}
+	if *sinceLastRunPath != "" && (*watch > 0 || *namesOnly || *allRecipients || *format != "table") {
+		return validationError("-since-last-run cannot be combined with -watch, -names-only, -all-recipients or -format other than table")
+	}
+	if *summaryJSON != "" && (*format != "table" || *sinceLastRunPath != "") {
+		return validationError("-summary-json requires -format table and cannot be combined with -since-last-run")
+	}
+	if *oneline && (*format != "table" || *namesOnly || *allRecipients || *onChange || *sinceLastRunPath != "" || *summaryJSON != "" || *showContacts) {
+		return validationError("-oneline cannot be combined with -format other than table, -names-only, -all-recipients, -on-change, -since-last-run, -summary-json or -contacts")
+	}
+	if *maxWidth < 0 || (*maxWidth > 0 && *maxWidth < minMaxWidth) {
+		return validationError("-max-width must be at least %d", minMaxWidth)
+	}
+	colors, err := newPalette(*colorFlag)
+	if err != nil {
+		return err
+	}
+	columns := defaultTableColumns
+	if *showTZ {
+		columns = []string{"name", "tz", "current", "next"}
+	}
+	if *columnsFlag != "" {
+		if *showTZ {
+			return validationError("-show-tz cannot be combined with -columns; add tz to -columns instead")
+		}
+		if columns, err = parseColumns(*columnsFlag); err != nil {
+			return err
+		}
+	}
+	// The participants column needs the rotations fetched, and -show-participants adds it
+	if hasColumn(columns, "participants") {
+		*showParticipants = true
+	} else if *showParticipants {
+		columns = append(columns[:len(columns):len(columns)], "participants")
+	}
+	if *showParticipants && (*namesOnly || *allRecipients) {
+		return validationError("-show-participants cannot be combined with -names-only or -all-recipients")
+	}
+	if *showContacts && (*namesOnly || *format == "prometheus-textfile" || *format == "template" || *format == "compact-json") {
+		return validationError("-contacts cannot be combined with -names-only or -format prometheus-textfile/template/compact-json")
+	}
+
+	// A zero queryAt means "now", evaluated on every poll
+	var queryAt time.Time
+	if *atFlag != "" {
+		if *watch > 0 {
+			return validationError("-at cannot be combined with -watch")
+		}
+		parsed, err := time.Parse(time.RFC3339, *atFlag)
+		if err != nil {
+			return validationError("invalid -at timestamp (expected RFC3339, e.g. 2024-12-01T08:00:00Z): %v", err)
+		}
+		queryAt = parsed.UTC()
+	}
+	if dateFlag != nil {
+		if *dateFlag == "" || *atFlag != "" || *watch > 0 {
+			return validationError("whoson requires -date and cannot be combined with -at or -watch")
+		}
+		parsed, _, err := parseRangeTime(*dateFlag)
+		if err != nil {
+			return validationError("invalid -date: %v", err)
+		}
+		queryAt = parsed
+	}
+
+	// The org-wide roster covers all schedules unless filtered
+	filters := scheduleFilters(args, *filterFlag, *allRecipients)
+	if *filterFile != "" {
+		fileFilters, err := loadFilterFile(*filterFile)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !filterFlagProvided(args):
+			filters = fileFilters
+		case len(filters) > 0:
+			filters = append(filters, fileFilters...)
+		}
+	}
+
+	client, cleanup, err := clientOpts.newClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	client.ExpandTeams = *expandTeams
+	client.RecipientType = *recipientType
+	client.Rotation = *rotation
+	client.IncludeParticipants = *showParticipants
+	if *retryOnEmpty {
+		client.EmptyRetryDelay = emptyRetryDelay
+	}
+
+	filteredSchedules, err := selectSchedules(client, filters, *enabledOnly, !*clientSideFilter)
+	if err != nil {
+		return err
+	}
+	if len(filteredSchedules) == 0 {
+		switch {
+		case *oneline || *failIfSoon:
+			// A status bar should show an error state, not an empty line, and a deploy gate
+			// must not pass without checking any schedule
+			return errors.New("no schedules match the filter")
+		case *format != "json" && *format != "compact-json" && *format != "prometheus-textfile":
+			return nil
+		}
+		// Machine-readable output is still written, empty, so consumers never parse nothing
+	}
+	if *format == "grafana" {
+		return serveGrafana(*listen, client, filteredSchedules)
+	}
+
+	var book *contactBook
+	if *showContacts {
+		book = newContactBook(client)
+	}
+	var notifier *handoffNotifier
+	if *webhookURL != "" {
+		if notifier, err = newHandoffNotifier(*webhookURL, *clientOpts.httpTimeout); err != nil {
+			return err
+		}
+	}
+
+	// fetchDuration is how long the last fetch took, for the -format compact-json run line
+	var fetchDuration time.Duration
+
+	// Print results
+	emit := func(statuses []*opsgenie.ScheduleStatus) error {
+		var contacts map[string][]opsgenie.Contact
+		if book != nil {
+			contacts = book.lookup(statuses)
+		}
+		if *format == "prometheus-textfile" {
+			return writeFileAtomically(*output, func(w io.Writer) {
+				writePrometheusMetrics(w, statuses)
+			})
+		}
+		if *format == "template" {
+			return executeTemplate(tmpl, statuses)
+		}
+		if *format == "compact-json" {
+			return writeCompactJSON(os.Stdout, statuses, queryAt, fetchDuration)
+		}
+		// jsonDocument is the -format json output, also written to -summary-json
+		jsonDocument := func() any {
+			if *allRecipients {
+				out := newRosterJSON(opsgenie.Roster(statuses), statuses, queryAt)
+				out.Contacts = newContactsJSON(contacts)
+				return out
+			}
+			out := newStatusesJSON(statuses, queryAt)
+			out.Contacts = newContactsJSON(contacts)
+			return out
+		}
+		if *format == "json" {
+			return writeJSON(os.Stdout, jsonDocument(), *jsonIndent)
+		}
+		if *summaryJSON != "" {
+			if err := writeJSONFile(*summaryJSON, jsonDocument()); err != nil {
+				return err
+			}
+		}
+		// Tables show display names; JSON keeps the raw recipients
+		display := statuses
+		if *normalize {
+			display = normalizeStatuses(statuses)
+		}
+		if *allRecipients {
+			printRoster(opsgenie.Roster(display), queryAt, humanDates{layout: *dateFormat})
+			if book != nil {
+				printContacts(contacts)
+			}
+			return nil
+		}
+		if *namesOnly {
+			printOnCallNames(statuses)
+			return nil
+		}
+		if *oneline {
+			printOneline(display, tableOptions{AbsoluteTimes: *absoluteTimes})
+			return nil
+		}
+		printScheduleStatusTable(display, tableOptions{At: queryAt, CompactEmpty: *compactEmpty, Columns: columns, Dates: humanDates{layout: *dateFormat}, Colors: colors, MaxWidth: *maxWidth, AbsoluteTimes: *absoluteTimes})
+		if book != nil {
+			printContacts(contacts)
+		}
+		return nil
+	}
+
+	// Fetch statuses for all filtered schedules
+	fetch := func() []*opsgenie.ScheduleStatus {
+		at := queryAt
+		if at.IsZero() {
+			at = time.Now().UTC()
+		}
+		started := time.Now()
+		statuses := client.Statuses(filteredSchedules, at)
+		fetchDuration = time.Since(started)
+		logStatusWarnings(statuses)
+		sortStatuses(statuses, *sortMode)
+		if notifier != nil {
+			notifier.check(statuses)
+		}
+		return statuses
+	}
+
+	if *watch == 0 {
+		statuses := fetch()
+		if *sinceLastRunPath != "" {
+			if err := sinceLastRun(*sinceLastRunPath, statuses); err != nil {
+				return err
+			}
+		} else if err := emit(statuses); err != nil {
+			return err
+		}
+		if *failIfSoon {
+			if err := handoffSoon(statuses); err != nil {
+				return err
+			}
+		}
+		return partialFailure(statuses)
+	}
+	return watchStatuses(fetch, emit, *watch, *onChange, *format == "table" && !*oneline)
+}
+
+// defaultScheduleFilters are the key schedules shown when -filter is not given
+var defaultScheduleFilters = []string{
+	"Archiving Team Schedule",
+	"DIP Ingestion schedule",
+	"DIP Processing schedule",
+	"L1 - Customer Support",
+	"NextGen SRE Team_schedule",
+	"Pathfinder_schedule",
+	"Quantum A-Team schedule",
+	"Quantum S-Team schedule",
+}
+
+// scheduleFilters resolves the -filter flag: an explicit -filter "" selects all schedules,
+// and without -filter the default key schedules are used unless allByDefault is set
+func scheduleFilters(args []string, filterFlag string, allByDefault bool) []string {
+	filterProvided := filterFlagProvided(args)
+
+	switch {
+	case (filterProvided && filterFlag == "") || (!filterProvided && allByDefault):
+		return []string{}
+	case filterFlag != "":
+		return strings.Split(filterFlag, ",")
+	default:
+		return defaultScheduleFilters
+	}
+}
+
+// filterFlagProvided reports whether -filter was set explicitly, even to ""
+func filterFlagProvided(args []string) bool {
+	for _, arg := range args {
+		if arg == "-filter" || arg == "--filter" || strings.HasPrefix(arg, "-filter=") || strings.HasPrefix(arg, "--filter=") {
+			return true
+		}
+	}
+	return false
+}
+
+// loadFilterFile reads schedule names or IDs from path, one per line. Blank lines and lines
+// starting with # are skipped.
+func loadFilterFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, validationError("cannot read -filter-file: %v", err)
+	}
+	var filters []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		filters = append(filters, line)
+	}
+	if len(filters) == 0 {
+		return nil, validationError("-filter-file %s lists no schedules", path)
+	}
+	return filters, nil
+}
+
+// selectSchedules fetches the schedules matching filters, leaving out disabled ones when
+// enabledOnly is set so they cost no on-call requests. When there are none it logs why and
+// returns an empty list. Filters matching no schedule are warned about together with the
+// closest schedule names, since they are usually typos.
+func selectSchedules(client *opsgenie.Client, filters []string, enabledOnly, serverQuery bool) ([]opsgenie.Schedule, error) {
+	var schedules []opsgenie.Schedule
+	if query := scheduleNameQuery(filters); serverQuery && query != "" {
+		found, _, err := client.SearchSchedules(query)
+		if opsgenie.KindOf(err) == opsgenie.KindAuth {
+			return nil, err
+		}
+		// Otherwise, unless every filter matched (not so for an ID filter, a query the API
+		// handles differently or a failed search), the full list is fetched below, which
+		// the suggestions need anyway
+		if err == nil && matchesEvery(found, filters) {
+			schedules = found
+		}
+	}
+	if schedules == nil {
+		var err error
+		if schedules, err = client.Schedules(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(schedules) == 0 {
+		log.Printf("No schedules exist in this account (or the API key cannot see any)")
+		return nil, nil
+	}
+
+	// The list API has no server-side filter for enabled schedules
+	var filteredSchedules []opsgenie.Schedule
+	for _, schedule := range schedules {
+		if matchesFilter(schedule, filters) && (schedule.Enabled || !enabledOnly) {
+			filteredSchedules = append(filteredSchedules, schedule)
+		}
+	}
+
+	for _, filter := range filters {
+		switch {
+		case !matchesAny(schedules, filter):
+			log.Printf("Warning: no schedule matches %q%s", strings.TrimSpace(filter), didYouMean(suggestSchedules(filter, schedules)))
+		case enabledOnly && !matchesAny(filteredSchedules, filter):
+			log.Printf("Warning: %q only matches disabled schedules; use -enabled-only=false to include them", strings.TrimSpace(filter))
+		}
+	}
+	if len(filteredSchedules) == 0 {
+		log.Printf("No schedules found matching the filter criteria")
+	}
+	return filteredSchedules, nil
+}
+
+// scheduleNameQuery returns an OpsGenie search query for schedules named like any of
+// filters, e.g. `name:"Production" OR name:"Database"`, or "" when there are no filters or
+// one cannot be quoted safely, in which case only client-side filtering applies
+func scheduleNameQuery(filters []string) string {
+	var terms []string
+	for _, filter := range filters {
+		filter = strings.TrimSpace(filter)
+		if filter == "" || strings.ContainsAny(filter, `"\*?`) {
+			return ""
+		}
+		terms = append(terms, `name:"`+filter+`"`)
+	}
+	return strings.Join(terms, " OR ")
+}
+
+// matchesEvery reports whether every filter matches at least one of schedules
+func matchesEvery(schedules []opsgenie.Schedule, filters []string) bool {
+	for _, filter := range filters {
+		if !matchesAny(schedules, filter) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAny(schedules []opsgenie.Schedule, filter string) bool {
+	for _, schedule := range schedules {
+		if matchesFilter(schedule, []string{filter}) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesFilter(schedule opsgenie.Schedule, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+
+	scheduleName := strings.ToLower(schedule.Name)
+	scheduleID := strings.ToLower(schedule.ID)
+
+	for _, filter := range filters {
+		filterLower := strings.ToLower(strings.TrimSpace(filter))
+		// Exact match for schedule name or substring match for ID
+		if scheduleName == filterLower || strings.Contains(scheduleID, filterLower) {
+			return true
+		}
+	}
+	return false
+}
+
+// logStatusWarnings reports schedules whose lookups failed without aborting the table
+func logStatusWarnings(statuses []*opsgenie.ScheduleStatus) {
+	for _, status := range statuses {
+		if errors.Is(status.Err, opsgenie.ErrNotFound) {
+			log.Printf("Warning: Schedule %s no longer exists; it was removed after the schedule list was fetched", status.ScheduleName)
+			continue
+		}
+		if errors.Is(status.Err, context.DeadlineExceeded) {
+			log.Printf("Warning: Schedule %s was not fetched before -timeout", status.ScheduleName)
+			continue
+		}
+		if status.Err != nil {
+			log.Printf("Warning: Failed to fetch on-call for schedule %s: %v", status.ScheduleName, status.Err)
+		}
+		if status.ShiftErr != nil {
+			log.Printf("Warning: Failed to fetch shift timing for schedule %s: %v", status.ScheduleName, status.ShiftErr)
+		}
+		if status.NextErr != nil {
+			log.Printf("Warning: Failed to fetch next on-call for schedule %s: %v", status.ScheduleName, status.NextErr)
+		}
+		if status.ParticipantsErr != nil {
+			log.Printf("Warning: Failed to fetch rotation participants for schedule %s: %v", status.ScheduleName, status.ParticipantsErr)
+		}
+	}
+}
+
+// partialFailure returns an errPartialFailure error when the on-call lookup of any schedule
+// failed. Schedules removed during the run are not failures.
+func partialFailure(statuses []*opsgenie.ScheduleStatus) error {
+	failed := 0
+	for _, status := range statuses {
+		if status.Err != nil && !errors.Is(status.Err, opsgenie.ErrNotFound) {
+			failed++
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w (%d of %d)", errPartialFailure, failed, len(statuses))
+}
+
+// handoffSoon returns an errHandoffSoon error naming the schedules whose shift ends within the
+// hour, or whose shift end could not be fetched, since a handoff cannot be ruled out for them
+func handoffSoon(statuses []*opsgenie.ScheduleStatus) error {
+	var ending []string
+	for _, status := range statuses {
+		switch {
+		case status.ShiftErr != nil:
+			ending = append(ending, fmt.Sprintf("%s (shift end unknown)", cleanScheduleName(status.ScheduleName)))
+		case status.ShiftEndsSoon:
+			ending = append(ending, fmt.Sprintf("%s (in %s)", cleanScheduleName(status.ScheduleName), humanizeDuration(status.ShiftEndsIn())))
+		}
+	}
+	if len(ending) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", errHandoffSoon, strings.Join(ending, ", "))
+}
+
+// statusErrorText is the placeholder shown in the table when a schedule's lookup failed
+func statusErrorText(err error) string {
+	if errors.Is(err, opsgenie.ErrNotFound) {
+		return "(schedule removed)"
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "(timed out)"
+	}
+	if opsgenie.KindOf(err) == opsgenie.KindParse {
+		return "(parse error)"
+	}
+	return "(error fetching)"
+}
+
+// truncate shortens s to at most maxWidth terminal columns, ending in "..." when it was cut.
+// It cuts between runes, so multibyte names stay valid UTF-8; invalid bytes become U+FFFD.
+func truncate(s string, maxWidth int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if displayWidth(s) <= maxWidth {
+		return s
+	}
+	width := 0
+	for i, r := range s {
+		if width+runeWidth(r) > maxWidth-3 {
+			return s[:i] + "..."
+		}
+		width += runeWidth(r)
+	}
+	return s
+}
+
+// padRight pads s with spaces to width terminal columns, like %-*s but counting wide
+// characters as two columns so tables with CJK names stay aligned
+func padRight(s string, width int) string {
+	if pad := width - displayWidth(s); pad > 0 {
+		return s + strings.Repeat(" ", pad)
+	}
+	return s
+}
+
+// displayWidth is the number of terminal columns s takes up
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// runeWidth approximates the terminal columns of r: combining marks take none, East Asian
+// wide and fullwidth characters two, everything else one
+func runeWidth(r rune) int {
+	switch {
+	case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r):
+		return 0
+	case unicode.In(r, unicode.Han, unicode.Hangul, unicode.Hiragana, unicode.Katakana),
+		r >= 0xFF01 && r <= 0xFF60, r >= 0xFFE0 && r <= 0xFFE6:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// emptyRetryDelay is how long -retry-on-empty waits before querying an empty schedule again
+const emptyRetryDelay = 2 * time.Second
+
+func formatRecipients(recipients []string) string {
+	if len(recipients) == 0 {
+		return ""
+	}
+	// Strip @behavox.com from emails to save space
+	var cleanedRecipients []string
+	for _, recipient := range recipients {
+		cleanedRecipients = append(cleanedRecipients, stripRecipientDomain(recipient, recipientDomain))
+	}
+	return strings.Join(cleanedRecipients, ", ")
+}
+
+// fitRecipients formats recipients in at most width columns: as many as fit, followed by
+// "+N more" for the rest, rather than cutting a name in half. A width of 0 or less means
+// unlimited; a width too narrow for even one name and the count falls back to truncate.
+func fitRecipients(recipients []string, width int) string {
+	full := formatRecipients(recipients)
+	if width <= 0 || displayWidth(full) <= width {
+		return full
+	}
+	for shown := len(recipients) - 1; shown > 0; shown-- {
+		fitted := fmt.Sprintf("%s, +%d more", formatRecipients(recipients[:shown]), len(recipients)-shown)
+		if displayWidth(fitted) <= width {
+			return fitted
+		}
+	}
+	return truncate(full, width)
+}
+
+// narrower returns the width left of width after used columns, keeping 0 (unlimited) as is
+func narrower(width, used int) int {
+	if width <= 0 {
+		return width
+	}
+	return max(1, width-used)
+}
+
+// recipientDomain is the email domain dropped from recipients in tables
+const recipientDomain = "behavox.com"
+
+// stripRecipientDomain returns the local part of recipient when it is a plain, well-formed
+// email address in exactly domain (case-insensitive), and recipient unchanged otherwise,
+// so names like "ops@behavox.com.backup" or "Team <ops@behavox.com>" are never mangled
+func stripRecipientDomain(recipient, domain string) string {
+	address, err := mail.ParseAddress(recipient)
+	if err != nil || address.Name != "" || address.Address != recipient {
+		return recipient
+	}
+	at := strings.LastIndex(recipient, "@")
+	if at <= 0 || !strings.EqualFold(recipient[at+1:], domain) {
+		return recipient
+	}
+	return recipient[:at]
+}
+
+func cleanScheduleName(name string) string {
+	// Remove common suffixes to make names cleaner
+	name = strings.TrimSuffix(name, " Schedule")
+	name = strings.TrimSuffix(name, " schedule")
+	name = strings.TrimSuffix(name, "_schedule")
+	return name
+}
+
+// scheduleDisplayNames returns the cleaned name of each schedule, keyed by schedule ID and
+// truncated to width columns. Schedules whose displayed names would collide (ignoring case),
+// such as "Prod Schedule" and "Prod_schedule", or two long names cut to the same prefix, get
+// the start of their ID appended, e.g. "Prod (1b2c3d4e)", so the rows stay distinguishable.
+// Names never exceed width; in very narrow columns the ID is cut short to fit.
+func scheduleDisplayNames(statuses []*opsgenie.ScheduleStatus, width int) map[string]string {
+	ids := make(map[string]map[string]bool) // lowercased truncated name -> schedule IDs
+	for _, status := range statuses {
+		key := strings.ToLower(truncate(cleanScheduleName(status.ScheduleName), width))
+		if ids[key] == nil {
+			ids[key] = make(map[string]bool)
+		}
+		ids[key][status.ScheduleID] = true
+	}
+
+	names := make(map[string]string, len(statuses))
+	for _, status := range statuses {
+		name := cleanScheduleName(status.ScheduleName)
+		colliding := ids[strings.ToLower(truncate(name, width))]
+		if len(colliding) < 2 {
+			names[status.ScheduleID] = truncate(name, width)
+			continue
+		}
+		// Keep at least a 4-column name such as "P..." and cut the ID if the column is too
+		// narrow for all of it
+		id := shortScheduleID(status.ScheduleID, colliding)
+		if room := width - 4 - len(" ()"); len(id) > room {
+			id = id[:max(room, 1)]
+		}
+		suffix := " (" + id + ")"
+		names[status.ScheduleID] = truncate(truncate(name, width-displayWidth(suffix))+suffix, width)
+	}
+	return names
+}
+
+// shortScheduleID returns the first 8 characters of id, or as many more as it takes to tell
+// it apart from the other IDs in colliding
+func shortScheduleID(id string, colliding map[string]bool) string {
+	for n := 8; n < len(id); n++ {
+		unique := true
+		for other := range colliding {
+			if other != id && strings.HasPrefix(other, id[:n]) {
+				unique = false
+				break
+			}
+		}
+		if unique {
+			return id[:n]
+		}
+	}
+	return id
+}
+
+// sortStatuses orders statuses for display; ties always fall back to the schedule name
+func sortStatuses(statuses []*opsgenie.ScheduleStatus, mode string) {
+	sort.SliceStable(statuses, func(i, j int) bool {
+		a, b := statuses[i], statuses[j]
+		switch mode {
+		case "shift-end":
+			// Schedules without a known shift end go last
+			if !a.ShiftEndsAt.Equal(b.ShiftEndsAt) {
+				if a.ShiftEndsAt.IsZero() || b.ShiftEndsAt.IsZero() {
+					return b.ShiftEndsAt.IsZero()
+				}
+				return a.ShiftEndsAt.Before(b.ShiftEndsAt)
+			}
+		case "status":
+			if statusRank(a) != statusRank(b) {
+				return statusRank(a) < statusRank(b)
+			}
+		}
+		return a.ScheduleName < b.ScheduleName
+	})
+}
+
+// statusRank orders schedules with no one on call first, then failed lookups, then covered
+// and disabled ones
+func statusRank(status *opsgenie.ScheduleStatus) int {
+	switch {
+	case status.Err != nil:
+		return 1
+	case status.Disabled:
+		return 2
+	case len(status.CurrentOnCall) == 0:
+		return 0
+	default:
+		return 2
+	}
+}
+
+// tableOptions controls how printScheduleStatusTable renders statuses
+type tableOptions struct {
+	At           time.Time // queried instant, or zero for now
+	CompactEmpty bool      // summarize schedules with no one on call in a footer line
+	Columns      []string  // column names in display order, see tableColumns
+	Dates        humanDates
+	Colors       palette
+	MaxWidth     int // width of the recipient columns, or 0 for each column's default
+	// AbsoluteTimes shows shift ends and starts as clock times in the schedule's time zone
+	AbsoluteTimes bool
+	// Names is the display name of each schedule ID, set by printScheduleStatusTable
+	Names map[string]string
+}
+
+// tableColumn is one column of the schedule status table
+type tableColumn struct {
+	header string
+	width  int
+	// recipients marks columns listing people, whose width -max-width sets
+	recipients bool
+	// value renders the cell of status, fitting people into width columns
+	value func(status *opsgenie.ScheduleStatus, opts tableOptions, width int) string
+	// color, if set, returns the ANSI color to highlight the cell of status with, or ""
+	color func(status *opsgenie.ScheduleStatus) string
+}
+
+// tableColumns are the columns -columns can select, keyed by name
+var tableColumns = map[string]tableColumn{
+	"name": {"Team Name", 40, false, func(status *opsgenie.ScheduleStatus, opts tableOptions, _ int) string {
+		return opts.Names[status.ScheduleID]
+	}, nil},
+	"current": {"Current On-Call", 50, true, func(status *opsgenie.ScheduleStatus, _ tableOptions, width int) string {
+		return formatCurrentColumn(status, width)
+	}, func(status *opsgenie.ScheduleStatus) string {
+		if status.Err != nil || (len(status.CurrentOnCall) == 0 && !status.Disabled) {
+			return ansiRed
+		}
+		return ""
+	}},
+	"next": {"Next On-Call", 50, true, func(status *opsgenie.ScheduleStatus, opts tableOptions, width int) string {
+		return formatNextColumn(status, opts, width)
+	}, func(status *opsgenie.ScheduleStatus) string {
+		switch {
+		case status.Err != nil:
+			return ""
+		case status.CoverageGap || status.NoSuccessor:
+			return ansiRed
+		case status.ShiftEndsSoon:
+			return ansiYellow
+		default:
+			return ""
+		}
+	}},
+	"tz": {"Time Zone (Local Time)", 30, false, func(status *opsgenie.ScheduleStatus, _ tableOptions, _ int) string {
+		return formatScheduleTime(status)
+	}, nil},
+	"participants": {"Rotation Participants", 60, true, func(status *opsgenie.ScheduleStatus, _ tableOptions, width int) string {
+		if status.ParticipantsErr != nil {
+			return statusErrorText(status.ParticipantsErr)
+		}
+		return fitRecipients(status.Participants, width)
+	}, nil},
+	"shift_end": {"Shift Ends", 36, false, func(status *opsgenie.ScheduleStatus, opts tableOptions, _ int) string {
+		if status.Err != nil || status.ShiftEndsAt.IsZero() {
+			return "-"
+		}
+		if opts.AbsoluteTimes {
+			return scheduleClock(status, status.ShiftEndsAt, "Mon 2 Jan 15:04 MST")
+		}
+		return fmt.Sprintf("%s (in %s)", opts.Dates.time(status.ShiftEndsAt), humanizeDuration(status.ShiftEndsIn()))
+	}, func(status *opsgenie.ScheduleStatus) string {
+		if status.Err == nil && status.ShiftEndsSoon {
+			return ansiYellow
+		}
+		return ""
+	}},
+}
+
+// tableColumnNames lists the valid column names in the order they are documented
+var tableColumnNames = []string{"name", "current", "next", "tz", "shift_end", "participants"}
+
+// minMaxWidth is the narrowest -max-width, enough for a short name and "+N more"
+const minMaxWidth = 20
+
+// defaultTableColumns is the table layout without -columns
+var defaultTableColumns = []string{"name", "current", "next"}
+
+// parseColumns validates a comma-separated -columns value
+func parseColumns(spec string) ([]string, error) {
+	var columns []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := tableColumns[name]; !ok {
+			return nil, validationError("unknown -columns entry %q (valid columns: %s)", name, strings.Join(tableColumnNames, ", "))
+		}
+		if seen[name] {
+			return nil, validationError("-columns lists %q more than once", name)
+		}
+		seen[name] = true
+		columns = append(columns, name)
+	}
+	return columns, nil
+}
+
+func hasColumn(columns []string, name string) bool {
+	for _, column := range columns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+func printScheduleStatusTable(statuses []*opsgenie.ScheduleStatus, opts tableOptions) {
+	if !opts.At.IsZero() {
+		fmt.Printf("On call at %s\n\n", opts.Dates.time(opts.At))
+	}
+
+	columns := make([]tableColumn, 0, len(opts.Columns))
+	for _, name := range opts.Columns {
+		column := tableColumns[name]
+		if column.recipients && opts.MaxWidth > 0 {
+			column.width = opts.MaxWidth
+		}
+		columns = append(columns, column)
+	}
+	opts.Names = scheduleDisplayNames(statuses, 38)
+
+	// Print header
+	cells := make([]string, len(columns))
+	width := 0
+	for i, column := range columns {
+		cells[i] = padRight(column.header, column.width)
+		width += column.width
+	}
+	fmt.Println(strings.Join(cells, " "))
+	fmt.Println(strings.Repeat("=", width))
+
+	var emptySchedules []string
+	for _, status := range statuses {
+		if opts.CompactEmpty && status.Err == nil && !status.Disabled && len(status.CurrentOnCall) == 0 {
+			emptySchedules = append(emptySchedules, opts.Names[status.ScheduleID])
+			continue
+		}
+		for i, column := range columns {
+			cells[i] = padRight(column.value(status, opts, column.width), column.width)
+			if column.color != nil {
+				cells[i] = opts.Colors.paint(column.color(status), cells[i])
+			}
+		}
+		fmt.Println(strings.Join(cells, " "))
+	}
+
+	if len(emptySchedules) > 0 {
+		fmt.Printf("\n%d schedules with no one on call: %s\n", len(emptySchedules), strings.Join(emptySchedules, ", "))
+	}
+}
+
+// formatCurrentColumn shows who is on call in width columns, or why no one is shown
+func formatCurrentColumn(status *opsgenie.ScheduleStatus, width int) string {
+	if status.Err != nil {
+		return statusErrorText(status.Err)
+	}
+	if status.Disabled {
+		// Whoever the response lists may be stale
+		return "(schedule disabled)"
+	}
+	if len(status.CurrentOnCall) == 0 {
+		return "No one on call"
+	}
+	return fitRecipients(status.CurrentOnCall, width)
+}
+
+// formatNextColumn shows who takes over when that is worth attention: the shift ends
+// within the hour, no one is covering it now, or no successor is scheduled. People are fitted
+// into width columns.
+func formatNextColumn(status *opsgenie.ScheduleStatus, opts tableOptions, width int) string {
+	switch {
+	case status.Err != nil || status.Disabled:
+		return ""
+	case status.CoverageGap:
+		const gap, next = "Gap in coverage now", ", next: "
+		if nextOnCall := formatUpcoming(status, opts, narrower(width, len(gap+next))); nextOnCall != "" {
+			return gap + next + nextOnCall
+		}
+		return gap
+	case len(status.CurrentOnCall) == 0:
+		return formatUpcoming(status, opts, width)
+	case status.NoSuccessor:
+		return fmt.Sprintf("(no successor scheduled) (%s)", formatWhen(status, status.ShiftEndsAt, opts))
+	case status.ShiftEndsSoon && len(status.NextOnCall) > 0:
+		in := fmt.Sprintf(" (%s)", formatWhen(status, status.ShiftEndsAt, opts))
+		return fitRecipients(status.NextOnCall, narrower(width, displayWidth(in))) + in
+	default:
+		return ""
+	}
+}
+
+// formatScheduleTime shows a schedule's time zone with its local time at the queried instant,
+// e.g. "Europe/London (03:12 Tue)"
+func formatScheduleTime(status *opsgenie.ScheduleStatus) string {
+	if status.Timezone == "" {
+		return "-"
+	}
+	loc, err := time.LoadLocation(status.Timezone)
+	if err != nil {
+		return truncate(status.Timezone, 28)
+	}
+	return fmt.Sprintf("%s (%s)", truncate(status.Timezone, 18), status.At.In(loc).Format("15:04 Mon"))
+}
+
+// formatUpcoming describes who is next on call for an uncovered schedule and when they
+// start, in width columns
+func formatUpcoming(status *opsgenie.ScheduleStatus, opts tableOptions, width int) string {
+	if status.NextShiftStartsAt.IsZero() {
+		return fitRecipients(status.NextOnCall, width)
+	}
+	starts := fmt.Sprintf(" (starts %s)", formatWhen(status, status.NextShiftStartsAt, opts))
+	next := fitRecipients(status.NextOnCall, narrower(width, displayWidth(starts)))
+	if next == "" {
+		next = "Next shift"
+	}
+	return next + starts
+}
+
+// formatWhen phrases when t comes: "in 45m" from the queried instant, or with -absolute-times
+// the clock time in the schedule's time zone, e.g. "at 14:00 CET"
+func formatWhen(status *opsgenie.ScheduleStatus, t time.Time, opts tableOptions) string {
+	if !opts.AbsoluteTimes {
+		return "in " + humanizeDuration(t.Sub(status.At))
+	}
+	// Name the day when it is not today, so a handoff tomorrow at 14:00 is not read as today
+	layout := "15:04 MST"
+	switch {
+	case t.Sub(status.At) >= 6*24*time.Hour:
+		layout = "2 Jan 15:04 MST"
+	case scheduleClock(status, t, time.DateOnly) != scheduleClock(status, status.At, time.DateOnly):
+		layout = "Mon 15:04 MST"
+	}
+	return "at " + scheduleClock(status, t, layout)
+}
+
+// scheduleClock formats t with layout in the schedule's time zone, or in UTC when the
+// schedule has none or it is unknown to this system
+func scheduleClock(status *opsgenie.ScheduleStatus, t time.Time, layout string) string {
+	loc, err := time.LoadLocation(status.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format(layout)
+}
+
+// humanizeDuration formats d as "45m", "3h 5m" or "2d 4h"; negative durations count as zero
+func humanizeDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	totalMinutes := int(d.Minutes())
+	days := totalMinutes / (24 * 60)
+	hours := totalMinutes / 60 % 24
+	minutes := totalMinutes % 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+// printOnCallNames prints the distinct people on call, one per line; like the table, disabled
+// schedules are left out
+func printOnCallNames(statuses []*opsgenie.ScheduleStatus) {
+	seen := make(map[string]bool)
+	var names []string
+	for _, status := range statuses {
+		if status.Disabled {
+			continue
+		}
+		for _, recipient := range status.CurrentOnCall {
+			if recipient == "" || seen[recipient] {
+				continue
+			}
+			seen[recipient] = true
+			names = append(names, recipient)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Println(name)
+	}
+}
+
+// printOneline prints every schedule's on-call people on a single line for -oneline, e.g.
+// "Production: alice (handoff in 45m) | Database: no one on call"
+func printOneline(statuses []*opsgenie.ScheduleStatus, opts tableOptions) {
+	names := scheduleDisplayNames(statuses, 38)
+	parts := make([]string, len(statuses))
+	for i, status := range statuses {
+		var summary string
+		switch {
+		case status.Err != nil:
+			summary = statusErrorText(status.Err)
+		case status.Disabled:
+			summary = "(schedule disabled)"
+		case len(status.CurrentOnCall) == 0:
+			summary = "no one on call"
+			if !status.NextShiftStartsAt.IsZero() {
+				summary += fmt.Sprintf(" (next %s)", formatWhen(status, status.NextShiftStartsAt, opts))
+			}
+		default:
+			summary = formatRecipients(status.CurrentOnCall)
+			if status.ShiftEndsSoon {
+				summary += fmt.Sprintf(" (handoff %s)", formatWhen(status, status.ShiftEndsAt, opts))
+			}
+		}
+		parts[i] = names[status.ScheduleID] + ": " + summary
+	}
+	fmt.Println(strings.Join(parts, " | "))
+}
+
+// printRoster prints everyone on call with the schedules they cover; at is the queried
+// instant, or zero for now
+func printRoster(roster []opsgenie.RosterEntry, at time.Time, dates humanDates) {
+	if !at.IsZero() {
+		fmt.Printf("On call at %s\n\n", dates.time(at))
+	}
+
+	fmt.Printf("%-40s %s\n", "Name", "Schedules")
+	fmt.Println(strings.Repeat("=", 140))
+	for _, entry := range roster {
+		schedules := make([]string, 0, len(entry.Schedules))
+		for _, schedule := range entry.Schedules {
+			schedules = append(schedules, cleanScheduleName(schedule))
+		}
+		fmt.Printf("%s %s\n", padRight(truncate(formatRecipients([]string{entry.Name}), 38), 40), strings.Join(schedules, ", "))
+	}
+	fmt.Printf("\n%d people on call\n", len(roster))
+}
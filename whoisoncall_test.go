@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scor2k/opsgenie-on-call/opsgenie"
+)
+
+func TestStripRecipientDomain(t *testing.T) {
+	tests := []struct {
+		name, recipient, want string
+	}{
+		{"address in the domain", "alice@behavox.com", "alice"},
+		{"dotted local part", "john.doe@behavox.com", "john.doe"},
+		{"mixed-case domain", "alice@Behavox.COM", "alice"},
+		{"other domain", "alice@example.com", "alice@example.com"},
+		{"subdomain", "alice@eu.behavox.com", "alice@eu.behavox.com"},
+		{"domain as prefix", "ops@behavox.com.backup", "ops@behavox.com.backup"},
+		{"display-name address", "Alice <alice@behavox.com>", "Alice <alice@behavox.com>"},
+		{"quoted display name", `"Ops Team" <ops@behavox.com>`, `"Ops Team" <ops@behavox.com>`},
+		{"bare angle address", "<alice@behavox.com>", "<alice@behavox.com>"},
+		{"no local part", "@behavox.com", "@behavox.com"},
+		{"non-email name", "Platform Team", "Platform Team"},
+		{"username", "alice", "alice"},
+		{"empty string", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripRecipientDomain(tt.recipient, recipientDomain); got != tt.want {
+				t.Errorf("stripRecipientDomain(%q) = %q, want %q", tt.recipient, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleDisplayNames(t *testing.T) {
+	tests := []struct {
+		name      string
+		schedules [][2]string // ID, name
+		width     int
+		want      map[string]string
+	}{
+		{
+			"distinct names",
+			[][2]string{{"1b2c3d4e-0001", "Prod Schedule"}, {"5f6a7b8c-0002", "Staging_schedule"}},
+			38,
+			map[string]string{"1b2c3d4e-0001": "Prod", "5f6a7b8c-0002": "Staging"},
+		},
+		{
+			"same cleaned name",
+			[][2]string{{"1b2c3d4e-0001", "Prod Schedule"}, {"5f6a7b8c-0002", "prod_schedule"}},
+			38,
+			map[string]string{"1b2c3d4e-0001": "Prod (1b2c3d4e)", "5f6a7b8c-0002": "prod (5f6a7b8c)"},
+		},
+		{
+			"same truncated name",
+			[][2]string{{"1b2c3d4e-0001", "Payments Platform EU"}, {"5f6a7b8c-0002", "Payments Platform US"}, {"9d0e1f2a-0003", "Search"}},
+			12,
+			map[string]string{"1b2c3d4e-0001": "P... (1b2c3)", "5f6a7b8c-0002": "P... (5f6a7)", "9d0e1f2a-0003": "Search"},
+		},
+		{
+			"same truncated name in a narrow column",
+			[][2]string{{"1b2c3d4e-0001", "Payments Platform EU"}, {"5f6a7b8c-0002", "Payments Platform US"}},
+			9,
+			map[string]string{"1b2c3d4e-0001": "P... (1b)", "5f6a7b8c-0002": "P... (5f)"},
+		},
+		{
+			"same truncated name with room for the ID",
+			[][2]string{{"1b2c3d4e-0001", "Payments Platform EU"}, {"5f6a7b8c-0002", "Payments Platform US"}},
+			18,
+			map[string]string{"1b2c3d4e-0001": "Paym... (1b2c3d4e)", "5f6a7b8c-0002": "Paym... (5f6a7b8c)"},
+		},
+		{
+			"shared ID prefix",
+			[][2]string{{"1b2c3d4e-0001", "Prod"}, {"1b2c3d4e-0002", "Prod"}},
+			38,
+			map[string]string{"1b2c3d4e-0001": "Prod (1b2c3d4e-0001)", "1b2c3d4e-0002": "Prod (1b2c3d4e-0002)"},
+		},
+		{
+			"same schedule twice",
+			[][2]string{{"1b2c3d4e-0001", "Prod Schedule"}, {"1b2c3d4e-0001", "Prod Schedule"}},
+			38,
+			map[string]string{"1b2c3d4e-0001": "Prod"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var statuses []*opsgenie.ScheduleStatus
+			for _, s := range tt.schedules {
+				statuses = append(statuses, &opsgenie.ScheduleStatus{ScheduleID: s[0], ScheduleName: s[1]})
+			}
+			got := scheduleDisplayNames(statuses, tt.width)
+			if len(got) != len(tt.want) {
+				t.Errorf("got %d names, want %d: %v", len(got), len(tt.want), got)
+			}
+			for id, want := range tt.want {
+				if got[id] != want {
+					t.Errorf("name of %s = %q, want %q", id, got[id], want)
+				}
+			}
+			for id, name := range got {
+				if displayWidth(name) > tt.width {
+					t.Errorf("name of %s = %q is %d columns wide, more than %d", id, name, displayWidth(name), tt.width)
+				}
+			}
+			// Reversing the input must not change any name
+			reversed := make([]*opsgenie.ScheduleStatus, len(statuses))
+			for i, status := range statuses {
+				reversed[len(statuses)-1-i] = status
+			}
+			for id, name := range scheduleDisplayNames(reversed, tt.width) {
+				if got[id] != name {
+					t.Errorf("name of %s changed with input order: %q, then %q", id, got[id], name)
+				}
+			}
+		})
+	}
+}
+
+func TestHandoffSoon(t *testing.T) {
+	at := time.Date(2025, 1, 6, 8, 0, 0, 0, time.UTC)
+	quiet := &opsgenie.ScheduleStatus{ScheduleName: "Search", At: at, ShiftEndsAt: at.Add(5 * time.Hour)}
+	tests := []struct {
+		name     string
+		status   *opsgenie.ScheduleStatus
+		wantFail bool
+	}{
+		{"shift ends later", &opsgenie.ScheduleStatus{ScheduleName: "Prod", At: at, ShiftEndsAt: at.Add(3 * time.Hour)}, false},
+		{"shift ends soon", &opsgenie.ScheduleStatus{ScheduleName: "Prod", At: at, ShiftEndsAt: at.Add(30 * time.Minute), ShiftEndsSoon: true}, true},
+		{"shift end unknown", &opsgenie.ScheduleStatus{ScheduleName: "Prod", At: at, ShiftErr: errors.New("timeline unavailable")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := handoffSoon([]*opsgenie.ScheduleStatus{quiet, tt.status})
+			if tt.wantFail != errors.Is(err, errHandoffSoon) {
+				t.Fatalf("handoffSoon() = %v, want failure %v", err, tt.wantFail)
+			}
+			if tt.wantFail && !strings.Contains(err.Error(), "Prod") {
+				t.Errorf("handoffSoon() = %v, want it to name Prod", err)
+			}
+		})
+	}
+}
+
+// replaySchedules saves a schedule list with only "Prod" for -from-file and returns its directory
+func replaySchedules(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	list := `{"data":[{"id":"s1","name":"Prod","enabled":true}]}`
+	if err := os.WriteFile(filepath.Join(dir, url.QueryEscape("/schedules")+".json"), []byte(list), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// captureStdout returns what fn writes to os.Stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-out
+}
+
+func TestFailIfSoonWithoutMatchingSchedules(t *testing.T) {
+	err := runWhoIsOnCallCommand([]string{"-from-file", replaySchedules(t), "-filter", "Staging", "-format", "json", "-fail-if-soon"})
+	if err == nil || exitCode(err) == exitOK {
+		t.Errorf("-fail-if-soon with no matching schedule = %v, want a failure", err)
+	}
+}
+
+func TestWhoIsOnCallWithoutMatchingSchedules(t *testing.T) {
+	dir := replaySchedules(t)
+	t.Run("json", func(t *testing.T) {
+		var err error
+		out := captureStdout(t, func() {
+			err = runWhoIsOnCallCommand([]string{"-from-file", dir, "-filter", "Staging", "-format", "json"})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc statusesJSON
+		if err := json.Unmarshal([]byte(out), &doc); err != nil {
+			t.Fatalf("output %q is not a JSON document: %v", out, err)
+		}
+		if len(doc.Schedules) != 0 || strings.HasPrefix(doc.At, "0001") {
+			t.Errorf("document = %+v, want no schedules at the current time", doc)
+		}
+	})
+	t.Run("compact-json", func(t *testing.T) {
+		var err error
+		out := captureStdout(t, func() {
+			err = runWhoIsOnCallCommand([]string{"-from-file", dir, "-filter", "Staging", "-format", "compact-json"})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var run compactRunJSON
+		if err := json.Unmarshal([]byte(out), &run); err != nil || run.Type != "run" || run.Schedules != 0 {
+			t.Errorf("output %q, want only a run line with no schedules (%v)", out, err)
+		}
+	})
+	t.Run("prometheus-textfile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "oncall.prom")
+		var err error
+		out := captureStdout(t, func() {
+			err = runWhoIsOnCallCommand([]string{"-from-file", dir, "-filter", "Staging", "-format", "prometheus-textfile", "-output", path})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "" {
+			t.Errorf("stdout = %q, want nothing", out)
+		}
+		metrics, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(metrics), "# TYPE opsgenie_schedule_has_oncall gauge") {
+			t.Errorf("metrics file = %q, want the metric headers", metrics)
+		}
+	})
+}
+
+func TestPrintOnCallNames(t *testing.T) {
+	statuses := []*opsgenie.ScheduleStatus{
+		{ScheduleName: "Prod", CurrentOnCall: []string{"bob", "alice"}},
+		{ScheduleName: "Database", CurrentOnCall: []string{"alice"}},
+		{ScheduleName: "Legacy", CurrentOnCall: []string{"carol"}, Disabled: true},
+	}
+	if got := captureStdout(t, func() { printOnCallNames(statuses) }); got != "alice\nbob\n" {
+		t.Errorf("printOnCallNames() printed %q, want alice and bob", got)
+	}
+}